@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+type amountMode int
+
+const (
+	amountAll amountMode = iota
+	amountFixed
+	amountPercent
+)
+
+// WithdrawAmount describes how much of the token balance gets forwarded:
+// "all", a fixed decimal amount such as "625.5", or a percentage like "50%".
+type WithdrawAmount struct {
+	mode  amountMode
+	value string
+}
+
+// ParseWithdrawAmount parses an amount spec, an empty spec means "all"
+func ParseWithdrawAmount(spec string) (*WithdrawAmount, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "" || strings.EqualFold(spec, "all"):
+		return &WithdrawAmount{mode: amountAll}, nil
+	case strings.HasSuffix(spec, "%"):
+		pct := strings.TrimSuffix(spec, "%")
+		bps, err := parseUnits(pct, 2)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentage %q: %w", spec, err)
+		}
+		if bps.Sign() == 0 || bps.Cmp(big.NewInt(10000)) > 0 {
+			return nil, fmt.Errorf("percentage %q out of range", spec)
+		}
+		return &WithdrawAmount{mode: amountPercent, value: pct}, nil
+	default:
+		if _, err := parseUnits(spec, 255); err != nil {
+			return nil, fmt.Errorf("invalid amount %q: %w", spec, err)
+		}
+		return &WithdrawAmount{mode: amountFixed, value: spec}, nil
+	}
+}
+
+func (w *WithdrawAmount) String() string {
+	switch w.mode {
+	case amountFixed:
+		return w.value
+	case amountPercent:
+		return w.value + "%"
+	}
+	return "all"
+}
+
+// Resolve the spec against the available balance into an exact amount
+func (w *WithdrawAmount) resolve(available *big.Int, decimals uint8) (*big.Int, error) {
+	switch w.mode {
+	case amountFixed:
+		amount, err := parseUnits(w.value, decimals)
+		if err != nil {
+			return nil, err
+		}
+		if amount.Cmp(available) > 0 {
+			return nil, fmt.Errorf("amount %s exceeds available %s", w.value, formatUnits(available, decimals))
+		}
+		return amount, nil
+	case amountPercent:
+		bps, err := parseUnits(w.value, 2)
+		if err != nil {
+			return nil, err
+		}
+		amount := new(big.Int).Mul(available, bps)
+		return amount.Div(amount, big.NewInt(10000)), nil
+	}
+	return new(big.Int).Set(available), nil
+}
+
+// Get the token balance of the account
+func (cl *Claimer) tokenBalance() (*big.Int, error) {
+	balance, err := cl.tokenContract.BalanceOf(&bind.CallOpts{}, cl.account.address)
+	if err != nil {
+		log.Printf("Failed to get token balance: %v", err)
+		return nil, err
+	}
+	return balance, nil
+}
+
+// Work out the exact transfer amount once claimable tokens have landed
+func (cl *Claimer) withdrawAmount(spec *WithdrawAmount, claimable *big.Int) (*big.Int, error) {
+	balance, err := cl.tokenBalance()
+	if err != nil {
+		return nil, err
+	}
+	decimals, err := cl.tokenDecimals()
+	if err != nil {
+		return nil, err
+	}
+	available := new(big.Int).Add(balance, claimable)
+	amount, err := spec.resolve(available, decimals)
+	if err != nil {
+		log.Printf("Failed to resolve withdraw amount: %v", err)
+		return nil, err
+	}
+	if amount.Sign() == 0 {
+		return nil, fmt.Errorf("nothing to withdraw")
+	}
+	return amount, nil
+}
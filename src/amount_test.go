@@ -0,0 +1,75 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseWithdrawAmount(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string // String() of the parsed amount, empty when rejected
+	}{
+		{"", "all"},
+		{"ALL", "all"},
+		{"625.5", "625.5"},
+		{"50%", "50%"},
+		{"0.01%", "0.01%"},
+		{"100%", "100%"},
+		{"0%", ""},
+		{"100.01%", ""},
+		{"12.345%", ""},
+		{"-5%", ""},
+		{"-1", ""},
+		{"1e3", ""},
+		{"1.2.3", ""},
+		{"half", ""},
+	}
+	for _, tt := range tests {
+		got, err := ParseWithdrawAmount(tt.spec)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseWithdrawAmount(%q) = %s, want an error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("ParseWithdrawAmount(%q) = %v, %v, want %s", tt.spec, got, err, tt.want)
+		}
+	}
+}
+
+func TestWithdrawAmountResolve(t *testing.T) {
+	tests := []struct {
+		spec      string
+		available int64
+		decimals  uint8
+		want      int64 // -1 when resolving fails
+	}{
+		{"all", 1234, 2, 1234},
+		{"5.5", 1234, 2, 550},
+		{"12.35", 1234, 2, -1},
+		{"5.555", 1234, 2, -1},
+		{"50%", 3, 0, 1},
+		{"33.33%", 100, 0, 33},
+		{"66.67%", 3, 0, 2},
+		{"0.01%", 9999, 0, 0},
+		{"100%", 1234, 2, 1234},
+	}
+	for _, tt := range tests {
+		spec, err := ParseWithdrawAmount(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseWithdrawAmount(%q): %v", tt.spec, err)
+		}
+		got, err := spec.resolve(big.NewInt(tt.available), tt.decimals)
+		if tt.want < 0 {
+			if err == nil {
+				t.Errorf("%s of %d = %v, want an error", tt.spec, tt.available, got)
+			}
+			continue
+		}
+		if err != nil || got.Cmp(big.NewInt(tt.want)) != 0 {
+			t.Errorf("%s of %d = %v, %v, want %d", tt.spec, tt.available, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/yaml.v3"
+)
+
+// WalletSpec is one entry of the wallet file. The account comes from a raw
+// hex key, an encrypted keystore file, or a mnemonic and a derivation path
+// range, in which case every derived account forwards to Destination.
+// PasswordFile holds the keystore passphrase, or the optional BIP-39
+// passphrase for a mnemonic. Delegate, when set, is where the wallet's
+// voting power goes.
+type WalletSpec struct {
+	Key          string `json:"key" yaml:"key"`
+	Keystore     string `json:"keystore" yaml:"keystore"`
+	MnemonicFile string `json:"mnemonicFile" yaml:"mnemonicFile"`
+	Path         string `json:"path" yaml:"path"`
+	PasswordFile string `json:"passwordFile" yaml:"passwordFile"`
+	Signer       string `json:"signer" yaml:"signer"`   // URL of a Clef compatible remote signer
+	Address      string `json:"address" yaml:"address"` // account at the remote signer
+	Destination  string `json:"destination" yaml:"destination"`
+	Delegate     string `json:"delegate" yaml:"delegate"`
+}
+
+// Wallet is an unlocked account together with where its tokens and voting
+// power go
+type Wallet struct {
+	Account     *Account
+	Destination string
+	Delegate    string
+}
+
+// Load wallets from a JSON or YAML file holding a list of WalletSpec
+func loadWallets(path string) ([]WalletSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Failed to read wallet file: %v", err)
+		return nil, err
+	}
+	var wallets []WalletSpec
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&wallets); err != nil {
+		log.Printf("Failed to parse wallet file: %v", err)
+		return nil, err
+	}
+	return wallets, nil
+}
+
+// Check that a wallet names exactly one account source and a destination
+func (w WalletSpec) validate() error {
+	sources := 0
+	for _, src := range []string{w.Key, w.Keystore, w.MnemonicFile, w.Signer} {
+		if src != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("need exactly one of key, keystore, mnemonicFile or signer")
+	}
+	if w.MnemonicFile != "" && w.Path == "" {
+		return fmt.Errorf("mnemonicFile needs a path")
+	}
+	if (w.Signer != "") != (w.Address != "") {
+		return fmt.Errorf("signer and address go together")
+	}
+	if w.Address != "" && (!common.IsHexAddress(w.Address) || isZeroAddress(w.Address)) {
+		return fmt.Errorf("invalid address %q", w.Address)
+	}
+	if !common.IsHexAddress(w.Destination) || isZeroAddress(w.Destination) {
+		return fmt.Errorf("invalid destination %q", w.Destination)
+	}
+	if w.Delegate != "" && (!common.IsHexAddress(w.Delegate) || isZeroAddress(w.Delegate)) {
+		return fmt.Errorf("invalid delegate %q", w.Delegate)
+	}
+	return nil
+}
+
+// isZeroAddress reports whether s is the zero address, which burns
+// whatever is sent or delegated to it
+func isZeroAddress(s string) bool {
+	return common.IsHexAddress(s) && common.HexToAddress(s) == (common.Address{})
+}
+
+// Unlock every wallet up front, so passphrase prompts don't interleave
+func openWallets(specs []WalletSpec) ([]*Wallet, error) {
+	wallets := make([]*Wallet, 0, len(specs))
+	for _, spec := range specs {
+		if spec.MnemonicFile != "" {
+			accs, err := loadMnemonicAccounts(spec.MnemonicFile, spec.PasswordFile, spec.Path)
+			if err != nil {
+				return nil, err
+			}
+			for _, account := range accs {
+				wallets = append(wallets, &Wallet{
+					Account:     account,
+					Destination: spec.Destination,
+					Delegate:    spec.Delegate,
+				})
+			}
+			continue
+		}
+		account, err := openAccount(spec)
+		if err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, &Wallet{
+			Account:     account,
+			Destination: spec.Destination,
+			Delegate:    spec.Delegate,
+		})
+	}
+	return wallets, nil
+}
+
+// Open the account of a wallet holding a single key, in a keystore, raw or
+// at a remote signer
+func openAccount(spec WalletSpec) (*Account, error) {
+	if spec.Signer != "" {
+		return NewRemoteAccount(spec.Signer, common.HexToAddress(spec.Address))
+	}
+	return loadAccount(spec.Key, spec.Keystore, spec.PasswordFile)
+}
+
+// Run the pipeline for every wallet, at most parallel at a time
+func runBatch(ctx context.Context, chain *Chain, settings *Settings, wallets []*Wallet) []*PipelineResult {
+	results := make([]*PipelineResult, len(wallets))
+	forEach(len(wallets), settings.Parallel, func(i int) {
+		results[i] = runWallet(ctx, chain, settings, wallets[i])
+	})
+	return results
+}
+
+// Call fn for every index below n, at most parallel at a time
+func forEach(n int, parallel int, fn func(i int)) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	sem := make(chan struct{}, parallel)
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func runWallet(ctx context.Context, chain *Chain, settings *Settings, w *Wallet) *PipelineResult {
+	claimer, err := newClaimer(settings.executor(chain, w.Account))
+	if err != nil {
+		return &PipelineResult{Address: w.Account.address, Destination: w.Destination, Err: err}
+	}
+	opts := settings.Pipeline
+	if w.Delegate != "" {
+		walletOpts := *opts
+		walletOpts.Delegate = common.HexToAddress(w.Delegate)
+		opts = &walletOpts
+	}
+	return runPipeline(ctx, claimer, w.Destination, opts)
+}
+
+// Print one line per wallet with amounts and transaction hashes
+func printSummary(out io.Writer, results []*PipelineResult) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WALLET\tDESTINATION\tCLAIMED\tFORWARDED\tCLAIM TX\tTRANSFER TX\tERROR")
+	for _, r := range results {
+		errText := "-"
+		if r.Err != nil {
+			errText = r.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Address.Hex(), r.Destination,
+			formatAmount(r.Claimed, r.Decimals), formatAmount(r.Forwarded, r.Decimals),
+			orDash(r.ClaimTx), orDash(r.WithdrawTx), errText)
+	}
+	tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
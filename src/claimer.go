@@ -1,122 +1,202 @@
 package main
 
 import (
-	"claimer/dist"
-	"context"
+	"errors"
+	"fmt"
 	"log"
-	"math"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
 
+	"claimer/dist"
 	"claimer/token"
 )
 
 type Claimer struct {
 	Executor
 	distContract  *dist.Dist
+	distAddress   common.Address
 	tokenContract *token.Token
+	tokenAddress  common.Address
 }
 
 // Builder distributor contract
-// https://arbiscan.io/address/0x67a24ce4321ab3af51c2d0a4801c3e111d88c9d9
 func (cl *Claimer) buildDistributor() error {
-	client := cl.Client()
-	distContract, err := dist.NewDist(common.HexToAddress("0x67a24CE4321aB3aF51c2D0a4801c3E111D88C9d9"), client)
+	client := cl.chain
+	address := cl.chain.Network.Distributor
+	if address == (common.Address{}) {
+		return fmt.Errorf("no distributor address for %s", cl.chain.Network.Name)
+	}
+	distContract, err := dist.NewDist(address, client)
 	if err != nil {
 		log.Printf("Failed to build distributor contract: %v", err)
 		return err
 	}
 	cl.distContract = distContract
+	cl.distAddress = address
 	return nil
 }
 
 // Builder token contract
-// https://arbiscan.io/address/0x912ce59144191c1204e64559fe8253a0e49e6548
 func (cl *Claimer) buildToken() error {
-	client := cl.Client()
-	tokenContract, err := token.NewToken(common.HexToAddress("0x912CE59144191C1204E64559FE8253a0e49E6548"), client)
+	client := cl.chain
+	address := cl.chain.Network.Token
+	if address == (common.Address{}) {
+		return fmt.Errorf("no token address for %s", cl.chain.Network.Name)
+	}
+	tokenContract, err := token.NewToken(address, client)
 	if err != nil {
 		log.Printf("Failed to build token contract: %v", err)
 		return err
 	}
 	cl.tokenContract = tokenContract
+	cl.tokenAddress = address
 	return nil
 }
 
-func (cl *Claimer) claim() (string, error) {
+var errNothingToClaim = errors.New("nothing to claim")
 
-	auth := bind.NewKeyedTransactor(cl.account.privateKey)
-	nonce, err := cl.getNonce()
+var errDelegationNonceUsed = errors.New("claimAndDelegate only works while the token nonce is 0, claim without a delegatee and delegate afterwards")
+
+// Get decimals of the token contract
+func (cl *Claimer) tokenDecimals() (uint8, error) {
+	decimals, err := cl.tokenContract.Decimals(&bind.CallOpts{})
 	if err != nil {
-		log.Printf("Failed to get nonce: %v", err)
-		return "", err
+		log.Printf("Failed to get decimals: %v", err)
+		return 0, err
 	}
-	auth.Nonce = big.NewInt(int64(nonce))
-	auth.Value = big.NewInt(0)     // in wei
-	auth.GasLimit = uint64(600000) // in units
-	auth.GasPrice = cl.getGasPrice()
+	return decimals, nil
+}
 
-	tx, err := cl.distContract.Claim(auth)
+// Check the allocation of the account before spending gas on a claim.
+// The distributor zeroes the allocation on claim, so an account that has
+// already claimed reports nothing to claim as well.
+func (cl *Claimer) checkEligibility() (*big.Int, error) {
+	amount, err := cl.distContract.ClaimableTokens(&bind.CallOpts{}, cl.account.address)
 	if err != nil {
-		log.Printf("Failed to claim: %v", err)
-		return "", err
+		log.Printf("Failed to get claimable tokens: %v", err)
+		return nil, err
 	}
-
-	signedTx, err := types.SignTx(tx, cl.chain.Signer, cl.account.privateKey)
+	decimals, err := cl.tokenDecimals()
 	if err != nil {
-		log.Printf("Failed to sign transaction: %v", err)
-		return "", err
+		return nil, err
 	}
-
-	client := cl.Client()
-	err = client.SendTransaction(context.Background(), signedTx)
+	symbol, err := cl.tokenContract.Symbol(&bind.CallOpts{})
 	if err != nil {
-		log.Printf("Failed to send transaction: %v", err)
-		return "", err
+		log.Printf("Failed to get symbol: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Claimable by %s: %s %s", cl.account.address.Hex(), formatUnits(amount, decimals), symbol)
+	if amount.Sign() == 0 {
+		return nil, errNothingToClaim
 	}
-	return signedTx.Hash().Hex(), nil
+	return amount, nil
 }
 
-func (cl *Claimer) withdrawTokens(to string, amount float64) (string, error) {
-	auth := bind.NewKeyedTransactor(cl.account.privateKey)
-	nonce, err := cl.getNonce()
-	if err != nil {
-		log.Printf("Failed to get nonce: %v", err)
-		return "", err
+// Send a signed transaction, or simulate it in a dry run
+func (cl *Claimer) sendTx(signedTx *types.Transaction) (string, error) {
+	if cl.dryRun != nil {
+		return cl.simulateTx(signedTx)
 	}
-	auth.Nonce = big.NewInt(int64(nonce))
-	auth.Value = big.NewInt(0)     // in wei
-	auth.GasLimit = uint64(600000) // in units
-	auth.GasPrice = cl.getGasPrice()
+	return cl.Executor.sendTx(signedTx)
+}
 
-	decimals, err := cl.tokenContract.Decimals(&bind.CallOpts{})
+// Build a claim, or with a delegatee a claim that also delegates the
+// voting power using an EIP-712 delegation signature checked by the token.
+// The distributor passes nonce 0 to delegateBySig, so the signature is made
+// at nonce 0 and refused once the account used a token nonce. Claims are
+// usually signed before the window opens, so the gas estimate assumes it
+// is open.
+func (cl *Claimer) claimCall(delegatee common.Address) (*Call, error) {
+	var call *Call
+	var err error
+	if delegatee == (common.Address{}) {
+		call, err = packCall(dist.DistMetaData, cl.distAddress, "claim")
+	} else {
+		var nonce *big.Int
+		nonce, err = cl.tokenContract.Nonces(&bind.CallOpts{}, cl.account.address)
+		if err != nil {
+			log.Printf("Failed to get token nonce: %v", err)
+			return nil, err
+		}
+		if nonce.Sign() != 0 {
+			return nil, fmt.Errorf("%w: nonce of %s is %s", errDelegationNonceUsed, cl.account.address.Hex(), nonce)
+		}
+		expiry := delegationExpiry()
+		var sig *Signature
+		sig, err = cl.signDelegationAt(delegatee, nonce, expiry)
+		if err != nil {
+			return nil, err
+		}
+		call, err = packCall(dist.DistMetaData, cl.distAddress, "claimAndDelegate", delegatee, expiry, sig.V, sig.R, sig.S)
+	}
 	if err != nil {
-		log.Printf("Failed to get decimals: %v", err)
-		return "", err
+		return nil, err
 	}
 
-	toAddress := common.HexToAddress(to)
-	amountBigInt := big.NewInt(int64(amount * math.Pow(10, float64(decimals))))
-	tx, err := cl.tokenContract.Transfer(auth, toAddress, amountBigInt)
-	if err != nil {
-		log.Printf("Failed to transfer tokens: %v", err)
-		return "", err
+	if code, err := cl.openWindowCode(); err != nil {
+		log.Printf("Failed to fake an open claim window: %v", err)
+	} else if code != nil {
+		call.Overrides = map[common.Address]gethclient.OverrideAccount{cl.distAddress: {Code: code}}
 	}
+	return call, nil
+}
 
-	signedTx, err := types.SignTx(tx, cl.chain.Signer, cl.account.privateKey)
+// Build a token transfer. It is signed before the claim is mined, so the
+// gas estimate assumes the claimable tokens are already in the balance.
+func (cl *Claimer) withdrawCall(to string, amount *big.Int) (*Call, error) {
+	call, err := packCall(token.TokenMetaData, cl.tokenAddress, "transfer", common.HexToAddress(to), amount)
 	if err != nil {
-		log.Printf("Failed to sign transaction: %v", err)
-		return "", err
+		return nil, err
 	}
 
-	client := cl.Client()
-	err = client.SendTransaction(context.Background(), signedTx)
+	claimable, err := cl.distContract.ClaimableTokens(&bind.CallOpts{}, cl.account.address)
+	if err == nil && claimable.Sign() > 0 {
+		if diff, err := cl.balanceOverride(cl.account.address, claimable); err != nil {
+			log.Printf("Failed to add the claim to the balance: %v", err)
+		} else {
+			call.Overrides = map[common.Address]gethclient.OverrideAccount{cl.tokenAddress: {StateDiff: diff}}
+		}
+	}
+	return call, nil
+}
+
+// Build a delegation of the voting power of the account
+func (cl *Claimer) delegateCall(to common.Address) (*Call, error) {
+	return packCall(token.TokenMetaData, cl.tokenAddress, "delegate", to)
+}
+
+// Build a submission of a delegation signed by another wallet
+func (cl *Claimer) delegateBySigCall(d *DelegationSignature) (*Call, error) {
+	var r, s [32]byte
+	copy(r[:], d.R)
+	copy(s[:], d.S)
+	return packCall(token.TokenMetaData, cl.tokenAddress, "delegateBySig", d.Delegatee, d.Nonce.ToInt(), d.Expiry.ToInt(), d.V, r, s)
+}
+
+// Build a submission of a permit letting the account spend value tokens of
+// owner
+func (cl *Claimer) permitCall(owner common.Address, value *big.Int, deadline *big.Int, sig *Signature) (*Call, error) {
+	return packCall(token.TokenMetaData, cl.tokenAddress, "permit", owner, cl.account.address, value, deadline, sig.V, sig.R, sig.S)
+}
+
+// Build a transfer of owner's tokens to to, spending the allowance of the
+// account. It is signed before the permit granting the allowance is mined,
+// so the gas estimate assumes the allowance is already there.
+func (cl *Claimer) transferFromCall(owner common.Address, to string, amount *big.Int) (*Call, error) {
+	call, err := packCall(token.TokenMetaData, cl.tokenAddress, "transferFrom", owner, common.HexToAddress(to), amount)
 	if err != nil {
-		log.Printf("Failed to send transaction: %v", err)
-		return "", err
+		return nil, err
+	}
+
+	if diff, err := cl.allowanceOverride(owner, amount); err != nil {
+		log.Printf("Failed to add the permit to the allowance: %v", err)
+	} else {
+		call.Overrides = map[common.Address]gethclient.OverrideAccount{cl.tokenAddress: {StateDiff: diff}}
 	}
-	return signedTx.Hash().Hex(), nil
+	return call, nil
 }
@@ -0,0 +1,666 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+
+	"claimer/token"
+)
+
+// command is one subcommand of the binary
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]*command{}
+
+func init() {
+	for _, cmd := range []*command{
+		{"run", "wait for the claim window, claim and forward the tokens", cmdRun},
+		{"status", "show the claim window, claimable amounts and balances", cmdStatus},
+		{"claim", "claim the allocation of every wallet", cmdClaim},
+		{"forward", "forward tokens of every wallet to its destination", cmdForward},
+		{"delegate", "delegate the voting power of every wallet", cmdDelegate},
+		{"delegate-sign", "sign gasless delegations for a relayer to submit", cmdDelegateSign},
+		{"delegate-relay", "submit signed delegations, paying gas from the relayer", cmdDelegateRelay},
+		{"votes", "show current and past voting power per wallet and delegate", cmdVotes},
+		{"rescue", "fund, claim and forward a wallet with a leaked key in one go", cmdRescue},
+		{"speed-up", "resend pending journaled transactions with higher fees", cmdSpeedUp},
+		{"cancel", "cancel pending journaled transactions with a zero value self-transfer", cmdCancel},
+		{"balance", "show token and ETH balances of every wallet", cmdBalance},
+		{"sweep-check", "look for signs of a sweeper bot and show when leftovers get swept", cmdSweepCheck},
+		{"import-key", "encrypt a raw private key into a keystore file", runImportKey},
+		{"stub-signer", "serve the configured keys over the Clef signer API, for testing", cmdStubSigner},
+	} {
+		commands[cmd.name] = cmd
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	tw := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", name, commands[name].usage)
+	}
+	tw.Flush()
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+// cliContext is what a command works with once flags and settings are loaded
+type cliContext struct {
+	ctx      context.Context
+	settings *Settings
+	chain    *Chain
+	json     bool
+}
+
+// Parse the flags of a command, load the settings and connect to the chain
+func setup(fs *flag.FlagSet, args []string) (*cliContext, error) {
+	pf := bindProfileFlags(fs)
+	jsonOut := fs.Bool("json", false, "print JSON instead of a table")
+	fs.Parse(args)
+
+	settings, err := loadSettings(fs, pf)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := NewChain(settings.Network, settings.RPC...)
+	if err != nil {
+		return nil, err
+	}
+	if settings.WS != "" {
+		if err := chain.dialWS(settings.WS); err != nil {
+			return nil, err
+		}
+	}
+	return &cliContext{
+		ctx:      context.Background(),
+		settings: settings,
+		chain:    chain,
+		json:     *jsonOut,
+	}, nil
+}
+
+// Unlock the configured wallets and build a Claimer for each of them
+func (c *cliContext) claimers() ([]*Claimer, []*Wallet, error) {
+	if len(c.settings.Wallets) == 0 {
+		return nil, nil, errors.New("no wallets configured")
+	}
+	wallets, err := openWallets(c.settings.Wallets)
+	if err != nil {
+		return nil, nil, err
+	}
+	claimers := make([]*Claimer, len(wallets))
+	for i, w := range wallets {
+		claimers[i], err = newClaimer(c.settings.executor(c.chain, w.Account))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return claimers, wallets, nil
+}
+
+// Unlock the relayer wallet, which pays gas on behalf of the others
+func (c *cliContext) relayer() (*Claimer, error) {
+	spec := c.settings.Relayer
+	if spec == nil {
+		return nil, errors.New("no relayer configured")
+	}
+	account, err := openAccount(*spec)
+	if err != nil {
+		return nil, err
+	}
+	return newClaimer(c.settings.executor(c.chain, account))
+}
+
+// Print v as JSON, or call table for human readable output
+func (c *cliContext) print(v interface{}, table func(w *tabwriter.Writer)) {
+	if c.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	table(tw)
+	tw.Flush()
+}
+
+// Print the simulated transactions of a dry run after the command report.
+// With -json they go to stderr so stdout stays valid JSON.
+func (c *cliContext) printDryRun() {
+	if c.settings.DryRun == nil {
+		return
+	}
+	var decimals uint8 = 18
+	if caller, err := token.NewTokenCaller(c.chain.Network.Token, c.chain); err == nil {
+		if d, err := caller.Decimals(&bind.CallOpts{}); err == nil {
+			decimals = d
+		}
+	}
+	out := os.Stdout
+	if c.json {
+		out = os.Stderr
+	}
+	fmt.Fprintln(out)
+	c.settings.DryRun.printReport(out, decimals)
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// errSomeFailed makes main exit with status 1 once the report is printed
+var errSomeFailed = errors.New("some wallets failed")
+
+func cmdRun(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	c, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(c.settings.Wallets) == 0 {
+		return errors.New("no wallets configured")
+	}
+	wallets, err := openWallets(c.settings.Wallets)
+	if err != nil {
+		return err
+	}
+	if c.settings.Pipeline.Gasless {
+		if c.settings.Pipeline.Relayer, err = c.relayer(); err != nil {
+			return err
+		}
+	}
+
+	results := runBatch(c.ctx, c.chain, c.settings, wallets)
+	type runReport struct {
+		Address     string `json:"address"`
+		Destination string `json:"destination"`
+		Claimed     string `json:"claimed,omitempty"`
+		Forwarded   string `json:"forwarded,omitempty"`
+		ClaimTx     string `json:"claimTx,omitempty"`
+		PermitTx    string `json:"permitTx,omitempty"`
+		TransferTx  string `json:"transferTx,omitempty"`
+		Error       string `json:"error,omitempty"`
+	}
+	var report []runReport
+	failed := false
+	for _, r := range results {
+		report = append(report, runReport{
+			Address:     r.Address.Hex(),
+			Destination: r.Destination,
+			Claimed:     amountOrEmpty(r.Claimed, r.Decimals),
+			Forwarded:   amountOrEmpty(r.Forwarded, r.Decimals),
+			ClaimTx:     r.ClaimTx,
+			PermitTx:    r.PermitTx,
+			TransferTx:  r.WithdrawTx,
+			Error:       errString(r.Err),
+		})
+		failed = failed || r.Err != nil
+	}
+	c.print(report, func(w *tabwriter.Writer) {
+		printSummary(w, results)
+	})
+	c.printDryRun()
+	if failed {
+		return errSomeFailed
+	}
+	return nil
+}
+
+func amountOrEmpty(amount *big.Int, decimals uint8) string {
+	if amount == nil {
+		return ""
+	}
+	return formatUnits(amount, decimals)
+}
+
+type windowReport struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+	Block uint64 `json:"block"`
+	State string `json:"state"`
+}
+
+// Get the claim window and where the chain is relative to it
+func claimWindowReport(cl *Claimer) (*windowReport, error) {
+	start, end, err := cl.claimWindow()
+	if err != nil {
+		return nil, err
+	}
+	block, err := cl.l1BlockNumber()
+	if err != nil {
+		return nil, err
+	}
+	state := "open"
+	if block < start {
+		state = "pending"
+	} else if block >= end {
+		state = "ended"
+	}
+	return &windowReport{Start: start, End: end, Block: block, State: state}, nil
+}
+
+func cmdStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	c, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	claimers, wallets, err := c.claimers()
+	if err != nil {
+		return err
+	}
+	window, err := claimWindowReport(claimers[0])
+	if err != nil {
+		return err
+	}
+	decimals, err := claimers[0].tokenDecimals()
+	if err != nil {
+		return err
+	}
+
+	type walletStatus struct {
+		Address     string `json:"address"`
+		Destination string `json:"destination"`
+		Claimable   string `json:"claimable"`
+		Balance     string `json:"balance"`
+		ETH         string `json:"eth"`
+		Delegate    string `json:"delegate"`
+		Error       string `json:"error,omitempty"`
+	}
+	report := struct {
+		Network string         `json:"network"`
+		ChainID string         `json:"chainId"`
+		Window  *windowReport  `json:"window"`
+		Wallets []walletStatus `json:"wallets"`
+	}{
+		Network: c.chain.Network.Name,
+		ChainID: c.chain.ChainID.String(),
+		Window:  window,
+		Wallets: make([]walletStatus, len(claimers)),
+	}
+	forEach(len(claimers), c.settings.Parallel, func(i int) {
+		cl := claimers[i]
+		st := walletStatus{Address: cl.account.address.Hex(), Destination: wallets[i].Destination}
+		defer func() { report.Wallets[i] = st }()
+
+		claimable, err := cl.distContract.ClaimableTokens(&bind.CallOpts{}, cl.account.address)
+		if err != nil {
+			st.Error = err.Error()
+			return
+		}
+		balance, err := cl.tokenBalance()
+		if err != nil {
+			st.Error = err.Error()
+			return
+		}
+		eth, err := cl.ethBalance()
+		if err != nil {
+			st.Error = err.Error()
+			return
+		}
+		delegatee, err := cl.tokenContract.Delegates(&bind.CallOpts{}, cl.account.address)
+		if err != nil {
+			st.Error = err.Error()
+			return
+		}
+		st.Claimable = formatUnits(claimable, decimals)
+		st.Balance = formatUnits(balance, decimals)
+		st.ETH = formatUnits(eth, 18)
+		st.Delegate = delegatee.Hex()
+	})
+
+	c.print(report, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Network:\t%s (chain %s)\n", report.Network, report.ChainID)
+		fmt.Fprintf(w, "Claim window:\tblocks %d to %d, current %d, %s\n\n", window.Start, window.End, window.Block, window.State)
+		fmt.Fprintln(w, "WALLET\tDESTINATION\tCLAIMABLE\tBALANCE\tETH\tDELEGATE\tERROR")
+		for _, st := range report.Wallets {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", st.Address, st.Destination,
+				orDash(st.Claimable), orDash(st.Balance), orDash(st.ETH), orDash(st.Delegate), orDash(st.Error))
+		}
+	})
+	return nil
+}
+
+// txReport is the outcome of a single action of one wallet
+type txReport struct {
+	Address string `json:"address"`
+	Amount  string `json:"amount,omitempty"`
+	Tx      string `json:"tx,omitempty"`
+	Block   uint64 `json:"block,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Run action for every wallet and print one line per wallet
+func (c *cliContext) forEachWallet(claimers []*Claimer, action func(cl *Claimer, r *txReport) error) error {
+	reports := make([]txReport, len(claimers))
+	forEach(len(claimers), c.settings.Parallel, func(i int) {
+		r := &reports[i]
+		r.Address = claimers[i].account.address.Hex()
+		if err := action(claimers[i], r); err != nil {
+			r.Error = err.Error()
+		}
+	})
+
+	failed := false
+	c.print(reports, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "WALLET\tAMOUNT\tTX\tBLOCK\tERROR")
+		for _, r := range reports {
+			block := "-"
+			if r.Block != 0 {
+				block = fmt.Sprint(r.Block)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Address, orDash(r.Amount), orDash(r.Tx), block, orDash(r.Error))
+		}
+	})
+	c.printDryRun()
+	for _, r := range reports {
+		failed = failed || r.Error != ""
+	}
+	if failed {
+		return errSomeFailed
+	}
+	return nil
+}
+
+func cmdClaim(args []string) error {
+	fs := flag.NewFlagSet("claim", flag.ExitOnError)
+	wait := fs.Bool("wait", false, "wait for the claim window to open")
+	c, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	claimers, _, err := c.claimers()
+	if err != nil {
+		return err
+	}
+	if !*wait {
+		// the gas estimate fakes an open window, so check the real one
+		window, err := claimWindowReport(claimers[0])
+		if err != nil {
+			return err
+		}
+		assumeOpen := c.settings.DryRun != nil && c.settings.DryRun.AssumeOpen
+		switch {
+		case window.State == "ended":
+			return errClaimWindowClosed
+		case window.State == "pending" && !assumeOpen:
+			return fmt.Errorf("%w: opens at block %d, current %d, use -wait", errClaimNotStarted, window.Start, window.Block)
+		}
+	}
+
+	return c.forEachWallet(claimers, func(cl *Claimer, r *txReport) error {
+		if _, err := cl.checkEligibility(); err != nil {
+			return err
+		}
+		scheduler := pipelineScheduler(cl, c.settings.Pipeline)
+		if *wait {
+			if err := scheduler.waitForWindow(c.ctx); err != nil {
+				return err
+			}
+		}
+		call, err := cl.claimCall(c.settings.Pipeline.Delegate)
+		if err != nil {
+			return err
+		}
+		var outcome *TxOutcome
+		r.Tx, outcome, err = cl.Submit(c.ctx, call, c.settings.Pipeline.ReceiptTimeout)
+		if outcome != nil {
+			r.Block = outcome.Block
+		}
+		if err != nil {
+			return err
+		}
+		if decimals, err := cl.tokenDecimals(); err == nil && outcome.Claimed != nil {
+			r.Amount = formatUnits(outcome.Claimed, decimals)
+		}
+		return nil
+	})
+}
+
+func cmdForward(args []string) error {
+	fs := flag.NewFlagSet("forward", flag.ExitOnError)
+	c, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	claimers, wallets, err := c.claimers()
+	if err != nil {
+		return err
+	}
+	dest := map[*Claimer]string{}
+	for i, cl := range claimers {
+		dest[cl] = wallets[i].Destination
+	}
+	var relayer *Claimer
+	if c.settings.Pipeline.Gasless {
+		if relayer, err = c.relayer(); err != nil {
+			return err
+		}
+	}
+
+	return c.forEachWallet(claimers, func(cl *Claimer, r *txReport) error {
+		amount, err := cl.withdrawAmount(c.settings.Pipeline.Amount, new(big.Int))
+		if err != nil {
+			return err
+		}
+		decimals, err := cl.tokenDecimals()
+		if err != nil {
+			return err
+		}
+		r.Amount = formatUnits(amount, decimals)
+		if relayer != nil {
+			scheduler := NewScheduler(cl)
+			scheduler.Backoff = c.settings.Pipeline.Backoff
+			_, hash, outcome, err := relayForward(c.ctx, scheduler, cl, relayer, dest[cl], amount, c.settings.Pipeline.ReceiptTimeout)
+			r.Tx = hash
+			if outcome != nil {
+				r.Block = outcome.Block
+			}
+			return err
+		}
+		call, err := cl.withdrawCall(dest[cl], amount)
+		if err != nil {
+			return err
+		}
+		var outcome *TxOutcome
+		r.Tx, outcome, err = cl.Submit(c.ctx, call, c.settings.Pipeline.ReceiptTimeout)
+		if outcome != nil {
+			r.Block = outcome.Block
+		}
+		return err
+	})
+}
+
+func cmdBalance(args []string) error {
+	fs := flag.NewFlagSet("balance", flag.ExitOnError)
+	c, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	claimers, wallets, err := c.claimers()
+	if err != nil {
+		return err
+	}
+	decimals, err := claimers[0].tokenDecimals()
+	if err != nil {
+		return err
+	}
+
+	type balanceReport struct {
+		Address     string `json:"address"`
+		Tokens      string `json:"tokens"`
+		ETH         string `json:"eth"`
+		Destination string `json:"destination"`
+		DestTokens  string `json:"destinationTokens"`
+		Error       string `json:"error,omitempty"`
+	}
+	reports := make([]balanceReport, len(claimers))
+	forEach(len(claimers), c.settings.Parallel, func(i int) {
+		cl := claimers[i]
+		r := &reports[i]
+		r.Address = cl.account.address.Hex()
+		r.Destination = wallets[i].Destination
+
+		tokens, err := cl.tokenBalance()
+		if err != nil {
+			r.Error = err.Error()
+			return
+		}
+		eth, err := cl.ethBalance()
+		if err != nil {
+			r.Error = err.Error()
+			return
+		}
+		destTokens, err := cl.tokenContract.BalanceOf(&bind.CallOpts{}, common.HexToAddress(r.Destination))
+		if err != nil {
+			r.Error = err.Error()
+			return
+		}
+		r.Tokens = formatUnits(tokens, decimals)
+		r.ETH = formatUnits(eth, 18)
+		r.DestTokens = formatUnits(destTokens, decimals)
+	})
+
+	c.print(reports, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "WALLET\tTOKENS\tETH\tDESTINATION\tDESTINATION TOKENS\tERROR")
+		for _, r := range reports {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Address, orDash(r.Tokens), orDash(r.ETH),
+				r.Destination, orDash(r.DestTokens), orDash(r.Error))
+		}
+	})
+	return nil
+}
+
+// sweep-check looks for the usual signs of a leaked key drained by a sweeper
+// bot: transactions queued that this tool did not send, and ETH taken out
+// of an account that was used before. It also shows when the distributor
+// allows unclaimed tokens to be swept.
+func cmdSweepCheck(args []string) error {
+	fs := flag.NewFlagSet("sweep-check", flag.ExitOnError)
+	c, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	claimers, _, err := c.claimers()
+	if err != nil {
+		return err
+	}
+	window, err := claimWindowReport(claimers[0])
+	if err != nil {
+		return err
+	}
+	receiver, err := claimers[0].distContract.SweepReceiver(&bind.CallOpts{})
+	if err != nil {
+		return err
+	}
+
+	type walletSweep struct {
+		Address      string   `json:"address"`
+		ETH          string   `json:"eth"`
+		Nonce        uint64   `json:"nonce"`
+		PendingNonce uint64   `json:"pendingNonce"`
+		Suspicious   bool     `json:"suspicious"`
+		Reasons      []string `json:"reasons,omitempty"`
+		Error        string   `json:"error,omitempty"`
+	}
+	blocksLeft := int64(window.End) - int64(window.Block)
+	if blocksLeft < 0 {
+		blocksLeft = 0
+	}
+	report := struct {
+		SweepReceiver    string        `json:"sweepReceiver"`
+		ClaimEnd         uint64        `json:"claimEnd"`
+		Block            uint64        `json:"block"`
+		BlocksUntilSweep int64         `json:"blocksUntilSweep"`
+		Wallets          []walletSweep `json:"wallets"`
+	}{
+		SweepReceiver:    receiver.Hex(),
+		ClaimEnd:         window.End,
+		Block:            window.Block,
+		BlocksUntilSweep: blocksLeft,
+		Wallets:          make([]walletSweep, len(claimers)),
+	}
+
+	forEach(len(claimers), c.settings.Parallel, func(i int) {
+		cl := claimers[i]
+		ws := walletSweep{Address: cl.account.address.Hex()}
+		defer func() { report.Wallets[i] = ws }()
+
+		eth, err := cl.ethBalance()
+		if err != nil {
+			ws.Error = err.Error()
+			return
+		}
+		nonce, err := cl.Client().NonceAt(c.ctx, cl.account.address, nil)
+		if err != nil {
+			ws.Error = err.Error()
+			return
+		}
+		pending, err := cl.getNonce()
+		if err != nil {
+			ws.Error = err.Error()
+			return
+		}
+		ws.ETH = formatUnits(eth, 18)
+		ws.Nonce = nonce
+		ws.PendingNonce = pending
+		if pending > nonce {
+			// transactions of this tool are in the journal, when it is on
+			if journaled, err := cl.pendingTxs(c.ctx); err == nil {
+				foreign := pending - nonce
+				for _, e := range journaled {
+					if e.Nonce < pending {
+						foreign--
+					}
+				}
+				if foreign > 0 {
+					ws.Reasons = append(ws.Reasons, fmt.Sprintf("%d pending transactions not sent by this tool", foreign))
+				}
+			} else {
+				ws.Reasons = append(ws.Reasons, fmt.Sprintf("%d pending transactions", pending-nonce))
+			}
+		}
+		if nonce > 0 && eth.Sign() == 0 {
+			ws.Reasons = append(ws.Reasons, "used account with no ETH left")
+		}
+		ws.Suspicious = len(ws.Reasons) > 0
+	})
+
+	c.print(report, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Sweep receiver:\t%s\n", report.SweepReceiver)
+		fmt.Fprintf(w, "Claim end:\tblock %d, current %d, %d blocks left\n\n", report.ClaimEnd, report.Block, report.BlocksUntilSweep)
+		fmt.Fprintln(w, "WALLET\tETH\tNONCE\tPENDING\tSUSPICIOUS\tREASONS\tERROR")
+		for _, ws := range report.Wallets {
+			reasons := "-"
+			if len(ws.Reasons) > 0 {
+				reasons = fmt.Sprint(ws.Reasons)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%v\t%s\t%s\n", ws.Address, orDash(ws.ETH), ws.Nonce, ws.PendingNonce,
+				ws.Suspicious, reasons, orDash(ws.Error))
+		}
+	})
+	return nil
+}
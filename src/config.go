@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the YAML configuration file. It holds named profiles and the
+// one used when no -profile flag is given.
+type Config struct {
+	Profile  string              `yaml:"profile"`
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+// Profile holds everything a run needs. Values are kept as written in the
+// file and only checked by resolve, so every problem is reported at once.
+type Profile struct {
+	Network        string          `yaml:"network"`
+	ChainID        uint64          `yaml:"chainId"`
+	RPC            []string        `yaml:"rpc"`
+	WS             string          `yaml:"ws"`
+	Contracts      ContractsConfig `yaml:"contracts"`
+	Gas            GasConfig       `yaml:"gas"`
+	Schedule       ScheduleConfig  `yaml:"schedule"`
+	ReceiptTimeout string          `yaml:"receiptTimeout"`
+	Withdraw       string          `yaml:"withdraw"`
+	Destination    string          `yaml:"destination"`
+	Delegate       string          `yaml:"delegate"`
+	Parallel       int             `yaml:"parallel"`
+	Wallets        []WalletSpec    `yaml:"wallets"`
+	WalletsFile    string          `yaml:"walletsFile"`
+	Relayer        WalletSpec      `yaml:"relayer"`
+	Funder         WalletSpec      `yaml:"funder"`
+	Gasless        bool            `yaml:"gasless"`
+	Journal        string          `yaml:"journal"`
+
+	envErrs []error // malformed environment variables
+}
+
+// ContractsConfig overrides the contract addresses of the network
+type ContractsConfig struct {
+	Distributor string `yaml:"distributor"`
+	Token       string `yaml:"token"`
+}
+
+// GasConfig is the fee policy, amounts are in gwei
+type GasConfig struct {
+	TipGwei           string  `yaml:"tipGwei"`
+	MaxFeeGwei        string  `yaml:"maxFeeGwei"`
+	BaseFeeMultiplier int64   `yaml:"baseFeeMultiplier"`
+	BumpPercent       int64   `yaml:"bumpPercent"`
+	ReplaceAfter      string  `yaml:"replaceAfter"`
+	MaxReplacements   int     `yaml:"maxReplacements"`
+	LimitMultiplier   float64 `yaml:"limitMultiplier"`
+	LimitCeiling      uint64  `yaml:"limitCeiling"`
+}
+
+// ScheduleConfig controls waiting for the claim window and retrying
+type ScheduleConfig struct {
+	LeadBlocks   uint64        `yaml:"leadBlocks"`
+	PollInterval string        `yaml:"pollInterval"`
+	Backoff      BackoffConfig `yaml:"backoff"`
+}
+
+// BackoffConfig is the retry delay between failed sends
+type BackoffConfig struct {
+	Initial    string  `yaml:"initial"`
+	Max        string  `yaml:"max"`
+	Multiplier float64 `yaml:"multiplier"`
+}
+
+// Settings is a validated profile, ready to run with
+type Settings struct {
+	Network  *Network
+	RPC      []string
+	WS       string
+	Fees     *FeePolicy
+	Pipeline *PipelineOptions
+	Wallets  []WalletSpec
+	Parallel int
+	DryRun   *DryRun     // nil unless -dry-run is given
+	Relayer  *WalletSpec // funded wallet paying gas for others, if any
+	Funder   *WalletSpec // funded wallet sending ETH to rescued wallets, if any
+	Journal  *Journal    // nil when disabled or in a dry run
+	journal  string      // path of the journal file, empty when disabled
+}
+
+// Build an Executor for account with the fee policy, dry run mode and
+// journal of the settings
+func (s *Settings) executor(chain *Chain, account *Account) *Executor {
+	ex := NewExecutorWithChain(chain, account)
+	ex.fees = s.Fees
+	ex.dryRun = s.DryRun
+	ex.journal = s.Journal
+	return ex
+}
+
+// profileFlags are the command line overrides shared by every command
+type profileFlags struct {
+	config     *string
+	profile    *string
+	network    *string
+	rpc        *string
+	ws         *string
+	dest       *string
+	delegate   *string
+	gasless    *bool
+	amount     *string
+	wallets    *string
+	parallel   *int
+	dryRun     *bool
+	assumeOpen *bool
+	journal    *string
+}
+
+func bindProfileFlags(fs *flag.FlagSet) *profileFlags {
+	return &profileFlags{
+		config:     fs.String("config", "config.yaml", "configuration file"),
+		profile:    fs.String("profile", "", "profile of the configuration file to use"),
+		network:    fs.String("network", "", "network name, overrides the profile"),
+		rpc:        fs.String("rpc", "", "comma separated RPC endpoints, overrides the profile"),
+		ws:         fs.String("ws", "", "websocket endpoint, overrides the profile"),
+		dest:       fs.String("dest", "", "destination address, overrides the profile"),
+		delegate:   fs.String("delegate", "", "claim and delegate voting power to this address in one transaction"),
+		amount:     fs.String("amount", "", `amount to forward: "all", a decimal amount or a percentage`),
+		wallets:    fs.String("wallets", "", "wallet file, overrides the profile"),
+		gasless:    fs.Bool("gasless", false, "forward tokens through the relayer with a permit"),
+		parallel:   fs.Int("parallel", 0, "wallets processed at the same time"),
+		dryRun:     fs.Bool("dry-run", false, "sign and simulate transactions without sending them"),
+		assumeOpen: fs.Bool("assume-open", false, "with -dry-run, simulate claims as if the claim window were open"),
+		journal:    fs.String("journal", "", `transaction journal file, "off" to disable`),
+	}
+}
+
+// Load the configuration file, apply environment and flag overrides and
+// validate the selected profile
+func loadSettings(fs *flag.FlagSet, pf *profileFlags) (*Settings, error) {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	cfg := &Config{}
+	data, err := os.ReadFile(*pf.config)
+	switch {
+	case err == nil:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", *pf.config, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && !set["config"]:
+		// no config file, run from environment and flags only
+	default:
+		return nil, err
+	}
+
+	name := cfg.Profile
+	if *pf.profile != "" {
+		name = *pf.profile
+	}
+	profile := &Profile{}
+	if name != "" {
+		p, ok := cfg.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: no profile %q", *pf.config, name)
+		}
+		profile = p
+	} else if len(cfg.Profiles) == 1 {
+		for n, p := range cfg.Profiles {
+			name, profile = n, p
+		}
+	} else if len(cfg.Profiles) > 1 {
+		return nil, fmt.Errorf("%s: several profiles and none selected", *pf.config)
+	}
+
+	profile.applyEnv()
+	profile.applyFlags(pf, set)
+	settings, err := profile.resolve("profiles." + name)
+	if err != nil {
+		return nil, err
+	}
+	if *pf.assumeOpen && !*pf.dryRun {
+		return nil, fmt.Errorf("-assume-open needs -dry-run")
+	}
+	if *pf.dryRun {
+		settings.DryRun = NewDryRun(*pf.assumeOpen)
+	} else if settings.journal != "" {
+		settings.Journal, err = OpenJournal(settings.journal)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return settings, nil
+}
+
+// Override profile values from environment variables. Malformed values
+// are kept for resolve to report.
+func (p *Profile) applyEnv() {
+	envErr := func(key string, format string, args ...interface{}) {
+		p.envErrs = append(p.envErrs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+	str := func(key string, dst *string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	str("NETWORK", &p.Network)
+	str("WS_NODE", &p.WS)
+	str("DEST_ADDRESS", &p.Destination)
+	str("DELEGATE_ADDRESS", &p.Delegate)
+	str("WITHDRAW_AMOUNT", &p.Withdraw)
+	str("FEE_TIP_GWEI", &p.Gas.TipGwei)
+	str("FEE_CAP_GWEI", &p.Gas.MaxFeeGwei)
+	str("REPLACE_AFTER", &p.Gas.ReplaceAfter)
+	if v := os.Getenv("GAS_LIMIT_MULTIPLIER"); v != "" {
+		if m, err := strconv.ParseFloat(v, 64); err != nil {
+			envErr("GAS_LIMIT_MULTIPLIER", "invalid number %q", v)
+		} else {
+			p.Gas.LimitMultiplier = m
+		}
+	}
+	if v := os.Getenv("GAS_LIMIT_CEILING"); v != "" {
+		if n, err := strconv.ParseUint(v, 10, 64); err != nil {
+			envErr("GAS_LIMIT_CEILING", "invalid number %q", v)
+		} else {
+			p.Gas.LimitCeiling = n
+		}
+	}
+	str("RECEIPT_TIMEOUT", &p.ReceiptTimeout)
+	str("WALLETS_FILE", &p.WalletsFile)
+	str("JOURNAL_FILE", &p.Journal)
+	if v := os.Getenv("HTTP_NODE"); v != "" {
+		p.RPC = strings.Split(v, ",")
+	}
+	if v := os.Getenv("CLAIM_LEAD_BLOCKS"); v != "" {
+		if n, err := strconv.ParseUint(v, 10, 64); err != nil {
+			envErr("CLAIM_LEAD_BLOCKS", "invalid number %q", v)
+		} else {
+			p.Schedule.LeadBlocks = n
+		}
+	}
+	if v := os.Getenv("BATCH_PARALLEL"); v != "" {
+		if n, err := strconv.Atoi(v); err != nil {
+			envErr("BATCH_PARALLEL", "invalid number %q", v)
+		} else {
+			p.Parallel = n
+		}
+	}
+
+	if v := os.Getenv("GASLESS_FORWARD"); v != "" {
+		if b, err := strconv.ParseBool(v); err != nil {
+			envErr("GASLESS_FORWARD", "invalid boolean %q", v)
+		} else {
+			p.Gasless = b
+		}
+	}
+	str("RELAYER_KEY", &p.Relayer.Key)
+	str("RELAYER_KEYSTORE", &p.Relayer.Keystore)
+	str("RELAYER_PASSWORD_FILE", &p.Relayer.PasswordFile)
+	str("FUNDER_KEY", &p.Funder.Key)
+	str("FUNDER_KEYSTORE", &p.Funder.Keystore)
+	str("FUNDER_PASSWORD_FILE", &p.Funder.PasswordFile)
+
+	// a single wallet from the environment replaces the configured ones
+	wallet := WalletSpec{
+		Key:          os.Getenv("PRV_KEY"),
+		Keystore:     os.Getenv("KEYSTORE"),
+		MnemonicFile: os.Getenv("MNEMONIC_FILE"),
+		Path:         os.Getenv("HD_PATH"),
+		PasswordFile: os.Getenv("PASSWORD_FILE"),
+		Signer:       os.Getenv("SIGNER_URL"),
+		Address:      os.Getenv("SIGNER_ADDRESS"),
+	}
+	if wallet.Key != "" || wallet.Keystore != "" || wallet.MnemonicFile != "" || wallet.Signer != "" {
+		if wallet.MnemonicFile != "" && wallet.Path == "" {
+			wallet.Path = "m/44'/60'/0'/0/0"
+		}
+		p.Wallets = []WalletSpec{wallet}
+		p.WalletsFile = ""
+	}
+}
+
+// Override profile values from flags that were set explicitly
+func (p *Profile) applyFlags(pf *profileFlags, set map[string]bool) {
+	if set["network"] {
+		p.Network = *pf.network
+	}
+	if set["rpc"] {
+		p.RPC = strings.Split(*pf.rpc, ",")
+	}
+	if set["ws"] {
+		p.WS = *pf.ws
+	}
+	if set["dest"] {
+		p.Destination = *pf.dest
+	}
+	if set["delegate"] {
+		p.Delegate = *pf.delegate
+	}
+	if set["gasless"] {
+		p.Gasless = *pf.gasless
+	}
+	if set["amount"] {
+		p.Withdraw = *pf.amount
+	}
+	if set["wallets"] {
+		p.WalletsFile = *pf.wallets
+		p.Wallets = nil
+	}
+	if set["parallel"] {
+		p.Parallel = *pf.parallel
+	}
+	if set["journal"] {
+		p.Journal = *pf.journal
+	}
+}
+
+// Validate the profile and convert it into Settings, reporting every
+// missing or malformed field
+func (p *Profile) resolve(path string) (*Settings, error) {
+	errs := append([]error{}, p.envErrs...)
+	fail := func(field string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s.%s: %s", path, field, fmt.Sprintf(format, args...)))
+	}
+
+	s := &Settings{
+		Fees:     DefaultFeePolicy(),
+		Parallel: 4,
+		Pipeline: &PipelineOptions{
+			LeadBlocks:     p.Schedule.LeadBlocks,
+			ReceiptTimeout: 2 * time.Minute,
+			PollInterval:   500 * time.Millisecond,
+			Backoff: Backoff{
+				Initial:    200 * time.Millisecond,
+				Max:        5 * time.Second,
+				Multiplier: 2,
+			},
+		},
+	}
+
+	// network and contracts
+	network, err := lookupNetwork(p.Network)
+	if err != nil {
+		if p.ChainID == 0 {
+			fail("network", "%v", err)
+		}
+		network = &Network{Name: p.Network}
+	}
+	if p.ChainID != 0 {
+		network.ChainID = new(big.Int).SetUint64(p.ChainID)
+	}
+	address := func(field string, value string, dst *common.Address) {
+		if value == "" {
+			return
+		}
+		if !common.IsHexAddress(value) {
+			fail(field, "invalid address %q", value)
+			return
+		}
+		*dst = common.HexToAddress(value)
+	}
+	address("contracts.distributor", p.Contracts.Distributor, &network.Distributor)
+	address("contracts.token", p.Contracts.Token, &network.Token)
+	s.Network = network
+
+	// endpoints
+	for _, url := range p.RPC {
+		if url = strings.TrimSpace(url); url != "" {
+			s.RPC = append(s.RPC, url)
+		}
+	}
+	if len(s.RPC) == 0 {
+		fail("rpc", "at least one endpoint is required")
+	}
+	s.WS = p.WS
+
+	// gas
+	gwei := func(field string, value string) *big.Int {
+		if value == "" {
+			return nil
+		}
+		amount, err := parseUnits(value, 9)
+		if err != nil {
+			fail(field, "%v", err)
+		}
+		return amount
+	}
+	if tip := gwei("gas.tipGwei", p.Gas.TipGwei); tip != nil {
+		s.Fees.TipCap = tip
+	}
+	s.Fees.MaxFeeCap = gwei("gas.maxFeeGwei", p.Gas.MaxFeeGwei)
+	if p.Gas.BaseFeeMultiplier < 0 {
+		fail("gas.baseFeeMultiplier", "must not be negative")
+	} else if p.Gas.BaseFeeMultiplier > 0 {
+		s.Fees.BaseFeeMultiplier = p.Gas.BaseFeeMultiplier
+	}
+	if p.Gas.BumpPercent != 0 && p.Gas.BumpPercent < minBumpPercent {
+		fail("gas.bumpPercent", "nodes refuse replacements below %d%%", minBumpPercent)
+	} else if p.Gas.BumpPercent != 0 {
+		s.Fees.BumpPercent = p.Gas.BumpPercent
+	}
+	if m := p.Gas.LimitMultiplier; m != 0 {
+		if m < 1 {
+			fail("gas.limitMultiplier", "must be at least 1")
+		} else {
+			s.Fees.GasMultiplier = m
+		}
+	}
+	if c := p.Gas.LimitCeiling; c != 0 {
+		if c < 21000 {
+			fail("gas.limitCeiling", "must be at least 21000")
+		} else {
+			s.Fees.GasCeiling = c
+		}
+	}
+	if p.Gas.MaxReplacements < 0 {
+		fail("gas.maxReplacements", "must not be negative")
+	} else if p.Gas.MaxReplacements > 0 {
+		s.Fees.MaxReplacements = p.Gas.MaxReplacements
+	}
+
+	// timings
+	duration := func(field string, value string, dst *time.Duration) {
+		if value == "" {
+			return
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			fail(field, "invalid duration %q", value)
+			return
+		}
+		*dst = d
+	}
+	duration("receiptTimeout", p.ReceiptTimeout, &s.Pipeline.ReceiptTimeout)
+	if p.Gas.ReplaceAfter != "off" {
+		duration("gas.replaceAfter", p.Gas.ReplaceAfter, &s.Fees.ReplaceAfter)
+	}
+	duration("schedule.pollInterval", p.Schedule.PollInterval, &s.Pipeline.PollInterval)
+	duration("schedule.backoff.initial", p.Schedule.Backoff.Initial, &s.Pipeline.Backoff.Initial)
+	duration("schedule.backoff.max", p.Schedule.Backoff.Max, &s.Pipeline.Backoff.Max)
+	if m := p.Schedule.Backoff.Multiplier; m != 0 {
+		if m < 1 {
+			fail("schedule.backoff.multiplier", "must be at least 1")
+		} else {
+			s.Pipeline.Backoff.Multiplier = m
+		}
+	}
+
+	// amounts and wallets
+	s.Pipeline.Amount, err = ParseWithdrawAmount(p.Withdraw)
+	if err != nil {
+		fail("withdraw", "%v", err)
+	}
+	if p.Parallel < 0 {
+		fail("parallel", "must not be negative")
+	} else if p.Parallel > 0 {
+		s.Parallel = p.Parallel
+	}
+	if p.Destination != "" && !common.IsHexAddress(p.Destination) {
+		fail("destination", "invalid address %q", p.Destination)
+	} else if isZeroAddress(p.Destination) {
+		fail("destination", "must not be the zero address")
+	}
+	if isZeroAddress(p.Delegate) {
+		fail("delegate", "must not be the zero address")
+	}
+	address("delegate", p.Delegate, &s.Pipeline.Delegate)
+
+	wallets := p.Wallets
+	if p.WalletsFile != "" {
+		if len(wallets) > 0 {
+			fail("walletsFile", "cannot be combined with wallets")
+		}
+		wallets, err = loadWallets(p.WalletsFile)
+		if err != nil {
+			fail("walletsFile", "%v", err)
+		}
+	}
+	for i, w := range wallets {
+		if w.Destination == "" {
+			w.Destination = p.Destination
+		}
+		if err := w.validate(); err != nil {
+			fail(fmt.Sprintf("wallets[%d]", i), "%v", err)
+		}
+		s.Wallets = append(s.Wallets, w)
+	}
+
+	// wallets paying for others hold a single key
+	single := func(field string, w WalletSpec) *WalletSpec {
+		sources := 0
+		for _, src := range []string{w.Key, w.Keystore, w.Signer} {
+			if src != "" {
+				sources++
+			}
+		}
+		switch {
+		case w == (WalletSpec{}):
+			return nil
+		case w.MnemonicFile != "" || w.Path != "" || w.Destination != "" || w.Delegate != "":
+			fail(field, "only key, keystore, passwordFile, signer and address are allowed")
+		case sources != 1:
+			fail(field, "need exactly one of key, keystore or signer")
+		case (w.Signer != "") != (w.Address != "") || (w.Address != "" && !common.IsHexAddress(w.Address)) || isZeroAddress(w.Address):
+			fail(field, "signer needs a valid address")
+		default:
+			return &w
+		}
+		return nil
+	}
+	s.Relayer = single("relayer", p.Relayer)
+	s.Funder = single("funder", p.Funder)
+	if p.Gasless && s.Relayer == nil {
+		fail("gasless", "needs a relayer")
+	}
+	s.Pipeline.Gasless = p.Gasless
+
+	switch p.Journal {
+	case "":
+		s.journal = "journal.json"
+	case "off":
+	default:
+		s.journal = p.Journal
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return s, nil
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+
+	"claimer/dist"
+	"claimer/token"
+)
+
+// DryRun replaces sending with simulation. Transactions are still built and
+// signed, then executed with eth_call and eth_estimateGas against the
+// current state and recorded instead of broadcast.
+type DryRun struct {
+	AssumeOpen bool // simulate claims as if the claim window were open
+
+	mu      sync.Mutex
+	sims    []*Simulation
+	byHash  map[common.Hash]*Simulation
+	claimed map[common.Address]*big.Int // simulated claims not yet on chain
+	funded  map[common.Address]*big.Int // simulated ETH transfers not yet on chain
+}
+
+// Slots of token balance and allowance mappings found so far, by token
+// address
+var balanceSlots, allowanceSlots sync.Map
+
+// Simulation is what a signed transaction would have done
+type Simulation struct {
+	Hash        common.Hash
+	From        common.Address
+	To          common.Address
+	Nonce       uint64
+	Call        string
+	Value       *big.Int
+	GasLimit    uint64
+	GasEstimate uint64   // zero when the node could not estimate
+	ExpectedFee *big.Int // at the current base fee
+	MaxFee      *big.Int // at the fee cap and gas limit
+	Claimed     *big.Int
+	Transfers   []*token.TokenTransfer
+	Err         error
+}
+
+func NewDryRun(assumeOpen bool) *DryRun {
+	return &DryRun{
+		AssumeOpen: assumeOpen,
+		byHash:     map[common.Hash]*Simulation{},
+		claimed:    map[common.Address]*big.Int{},
+		funded:     map[common.Address]*big.Int{},
+	}
+}
+
+func (d *DryRun) record(sim *Simulation) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sims = append(d.sims, sim)
+	d.byHash[sim.Hash] = sim
+	if sim.Err != nil {
+		return
+	}
+	add := func(m map[common.Address]*big.Int, account common.Address, amount *big.Int) {
+		total := new(big.Int).Set(amount)
+		if prev, ok := m[account]; ok {
+			total.Add(total, prev)
+		}
+		m[account] = total
+	}
+	if sim.Claimed != nil {
+		add(d.claimed, sim.From, sim.Claimed)
+	}
+	if sim.Value != nil && sim.Value.Sign() > 0 {
+		add(d.funded, sim.To, sim.Value)
+	}
+}
+
+func (d *DryRun) lookup(hash common.Hash) (*Simulation, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sim, ok := d.byHash[hash]
+	return sim, ok
+}
+
+// Amount the account would have received from simulated claims
+func (d *DryRun) pendingClaim(account common.Address) *big.Int {
+	return d.pending(d.claimed, account)
+}
+
+// ETH the account would have received from simulated transfers
+func (d *DryRun) pendingFunding(account common.Address) *big.Int {
+	return d.pending(d.funded, account)
+}
+
+func (d *DryRun) pending(m map[common.Address]*big.Int, account common.Address) *big.Int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if amount, ok := m[account]; ok {
+		return new(big.Int).Set(amount)
+	}
+	return new(big.Int)
+}
+
+// Print every simulated transaction with its fees and token movements
+func (d *DryRun) printReport(out io.Writer, decimals uint8) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DRY RUN\nFROM\tNONCE\tCALL\tGAS\tEXPECTED FEE\tMAX FEE\tTOKEN DELTA\tRESULT")
+	for _, sim := range d.sims {
+		gas := "-"
+		if sim.GasEstimate != 0 {
+			gas = fmt.Sprint(sim.GasEstimate)
+		}
+		result := "ok"
+		if sim.Err != nil {
+			result = sim.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s ETH\t%s ETH\t%s\t%s\n", sim.From.Hex(), sim.Nonce, sim.Call, gas,
+			formatAmount(sim.ExpectedFee, 18), formatAmount(sim.MaxFee, 18), sim.deltas(decimals), result)
+	}
+	tw.Flush()
+}
+
+// Token balance changes of a simulation, one per affected account
+func (sim *Simulation) deltas(decimals uint8) string {
+	if sim.Err != nil {
+		return "-"
+	}
+	var out []string
+	if sim.Claimed != nil {
+		out = append(out, fmt.Sprintf("%s +%s", sim.From.Hex(), formatUnits(sim.Claimed, decimals)))
+	}
+	for _, ev := range sim.Transfers {
+		out = append(out,
+			fmt.Sprintf("%s -%s", ev.From.Hex(), formatUnits(ev.Value, decimals)),
+			fmt.Sprintf("%s +%s", ev.To.Hex(), formatUnits(ev.Value, decimals)))
+	}
+	if len(out) == 0 {
+		return "-"
+	}
+	return fmt.Sprint(out)
+}
+
+// Simulate a signed transaction of the executor and record the result
+func (ex *Executor) simulate(tx *types.Transaction, overrides map[common.Address]gethclient.OverrideAccount) *Simulation {
+	sim := &Simulation{
+		Hash:     tx.Hash(),
+		From:     ex.account.address,
+		Nonce:    tx.Nonce(),
+		Call:     "transfer ETH",
+		Value:    tx.Value(),
+		GasLimit: tx.Gas(),
+	}
+	if tx.To() != nil {
+		sim.To = *tx.To()
+	}
+	if len(tx.Data()) > 0 {
+		sim.Call = describeCall(tx.Data())
+	}
+	msg := ethereum.CallMsg{
+		From:      ex.account.address,
+		To:        tx.To(),
+		Gas:       tx.Gas(),
+		GasFeeCap: tx.GasFeeCap(),
+		GasTipCap: tx.GasTipCap(),
+		Value:     tx.Value(),
+		Data:      tx.Data(),
+	}
+
+	ctx := context.Background()
+	var ovr *map[common.Address]gethclient.OverrideAccount
+	if len(overrides) > 0 {
+		ovr = &overrides
+	}
+	_, err := gethclient.New(ex.chain.RPC()).CallContract(ctx, msg, nil, ovr)
+	sim.Err = wrapRevert(err)
+
+	gas := tx.Gas()
+	if sim.Err == nil {
+		estimate, err := ex.estimateGas(ctx, msg, overrides)
+		if err != nil {
+			log.Printf("Failed to estimate gas of %s, using the gas limit: %v", sim.Call, err)
+		} else {
+			sim.GasEstimate = estimate
+			gas = estimate
+		}
+	}
+
+	sim.MaxFee = new(big.Int).Mul(tx.GasFeeCap(), new(big.Int).SetUint64(tx.Gas()))
+	if fees, err := ex.getFees(); err == nil {
+		price := new(big.Int).Add(fees.BaseFee, tx.GasTipCap())
+		if price.Cmp(tx.GasFeeCap()) > 0 {
+			price = tx.GasFeeCap()
+		}
+		sim.ExpectedFee = price.Mul(price, new(big.Int).SetUint64(gas))
+	}
+	return sim
+}
+
+// Estimate gas with eth_estimateGas, passing state overrides when there are
+// any. Nodes without override support for estimates return an error.
+func (ex *Executor) estimateGas(ctx context.Context, msg ethereum.CallMsg, overrides map[common.Address]gethclient.OverrideAccount) (uint64, error) {
+	if len(overrides) == 0 {
+		msg.Gas = 0
+		return ex.chain.EstimateGas(ctx, msg)
+	}
+	arg := map[string]interface{}{
+		"from":  msg.From,
+		"to":    msg.To,
+		"input": hexutil.Bytes(msg.Data),
+		"value": (*hexutil.Big)(msg.Value),
+	}
+	var gas hexutil.Uint64
+	err := ex.chain.RPC().CallContext(ctx, &gas, "eth_estimateGas", arg, "latest", overrides)
+	return uint64(gas), err
+}
+
+// Name the contract method called by data
+func describeCall(data []byte) string {
+	if len(data) < 4 {
+		return hexutil.Encode(data)
+	}
+	for _, meta := range []*bind.MetaData{dist.DistMetaData, token.TokenMetaData} {
+		parsed, err := meta.GetAbi()
+		if err != nil {
+			continue
+		}
+		if method, err := parsed.MethodById(data[:4]); err == nil {
+			return method.Name
+		}
+	}
+	return hexutil.Encode(data[:4])
+}
+
+// Simulate a claimer transaction with the state it would see in a real run:
+// an open claim window when assumed, and the tokens of earlier simulated
+// claims and the ETH of earlier simulated transfers in the balances
+func (cl *Claimer) simulateTx(tx *types.Transaction) (string, error) {
+	overrides := map[common.Address]gethclient.OverrideAccount{}
+	to := common.Address{}
+	if tx.To() != nil {
+		to = *tx.To()
+	}
+	call := describeCall(tx.Data())
+
+	isClaim := to == cl.distAddress && (call == "claim" || call == "claimAndDelegate")
+	if isClaim && cl.dryRun.AssumeOpen {
+		if code, err := cl.openWindowCode(); err != nil {
+			log.Printf("Failed to fake an open claim window: %v", err)
+		} else if code != nil {
+			overrides[cl.distAddress] = gethclient.OverrideAccount{Code: code}
+		}
+	}
+	if to == cl.tokenAddress {
+		// tokens move from the account, or from the owner of a permit
+		owner := cl.account.address
+		if transfer := decodeTransfer(cl.account.address, tx.Data()); transfer != nil && call == "transferFrom" {
+			owner = transfer.From
+			if diff, err := cl.allowanceOverride(owner, transfer.Value); err != nil {
+				log.Printf("Failed to add simulated permit to the allowance: %v", err)
+			} else {
+				overrides[cl.tokenAddress] = gethclient.OverrideAccount{StateDiff: diff}
+			}
+		}
+		if pending := cl.dryRun.pendingClaim(owner); pending.Sign() > 0 {
+			if diff, err := cl.balanceOverride(owner, pending); err != nil {
+				log.Printf("Failed to add simulated claim to the balance: %v", err)
+			} else {
+				merged := overrides[cl.tokenAddress]
+				if merged.StateDiff == nil {
+					merged.StateDiff = map[common.Hash]common.Hash{}
+				}
+				for k, v := range diff {
+					merged.StateDiff[k] = v
+				}
+				overrides[cl.tokenAddress] = merged
+			}
+		}
+	}
+
+	if funding := cl.dryRun.pendingFunding(cl.account.address); funding.Sign() > 0 {
+		if balance, err := cl.ethBalance(); err == nil {
+			overrides[cl.account.address] = gethclient.OverrideAccount{Balance: balance.Add(balance, funding)}
+		}
+	}
+
+	sim := cl.simulate(tx, overrides)
+	if sim.Err == nil {
+		cl.simulateEffects(sim, tx)
+	}
+	return cl.recordSimulation(sim)
+}
+
+// Record a simulation in place of sending, returning the hash the
+// transaction would have had
+func (ex *Executor) recordSimulation(sim *Simulation) (string, error) {
+	ex.dryRun.record(sim)
+	if sim.Err != nil {
+		log.Printf("Dry run: %s from %s at nonce %d would revert: %v", sim.Call, sim.From.Hex(), sim.Nonce, sim.Err)
+	} else {
+		log.Printf("Dry run: %s from %s at nonce %d would succeed, fee about %s ETH", sim.Call, sim.From.Hex(), sim.Nonce, formatAmount(sim.ExpectedFee, 18))
+	}
+	return sim.Hash.Hex(), nil
+}
+
+// Fill in the tokens a successful simulated transaction would move
+func (cl *Claimer) simulateEffects(sim *Simulation, tx *types.Transaction) {
+	switch {
+	case sim.To == cl.distAddress && (sim.Call == "claim" || sim.Call == "claimAndDelegate"):
+		claimable, err := cl.distContract.ClaimableTokens(&bind.CallOpts{}, cl.account.address)
+		if err != nil {
+			log.Printf("Failed to get claimable tokens: %v", err)
+			return
+		}
+		sim.Claimed = claimable
+	case sim.To == cl.tokenAddress && (sim.Call == "transfer" || sim.Call == "transferFrom"):
+		if transfer := decodeTransfer(cl.account.address, tx.Data()); transfer != nil {
+			sim.Transfers = append(sim.Transfers, transfer)
+		}
+	}
+}
+
+// Decode the tokens a transfer or transferFrom sent by account moves
+func decodeTransfer(account common.Address, data []byte) *token.TokenTransfer {
+	if len(data) < 4 {
+		return nil
+	}
+	parsed, err := token.TokenMetaData.GetAbi()
+	if err != nil {
+		return nil
+	}
+	method, err := parsed.MethodById(data[:4])
+	if err != nil {
+		return nil
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil
+	}
+	switch {
+	case method.Name == "transfer" && len(args) == 2:
+		return &token.TokenTransfer{From: account, To: args[0].(common.Address), Value: args[1].(*big.Int)}
+	case method.Name == "transferFrom" && len(args) == 3:
+		return &token.TokenTransfer{From: args[0].(common.Address), To: args[1].(common.Address), Value: args[2].(*big.Int)}
+	}
+	return nil
+}
+
+// Get the distributor code with the claim period start moved to the current
+// block. The start is an immutable, so it sits in the code as a 32 byte word.
+// Returns nil when the window is already open.
+func (cl *Claimer) openWindowCode() ([]byte, error) {
+	start, _, err := cl.claimWindow()
+	if err != nil {
+		return nil, err
+	}
+	block, err := cl.l1BlockNumber()
+	if err != nil {
+		return nil, err
+	}
+	if block >= start {
+		return nil, nil
+	}
+	code, err := cl.chain.CodeAt(context.Background(), cl.distAddress, nil)
+	if err != nil {
+		return nil, err
+	}
+	word := common.BigToHash(new(big.Int).SetUint64(start))
+	if !bytes.Contains(code, word[:]) {
+		return nil, fmt.Errorf("claim period start not found in the distributor code")
+	}
+	now := common.BigToHash(new(big.Int).SetUint64(block))
+	return bytes.ReplaceAll(code, word[:], now[:]), nil
+}
+
+// Get a storage override that raises the token balance of account by
+// amount. The slot of the balance mapping is found by probing.
+func (cl *Claimer) balanceOverride(account common.Address, amount *big.Int) (map[common.Hash]common.Hash, error) {
+	slot, err := cl.findBalanceSlot()
+	if err != nil {
+		return nil, err
+	}
+	balance, err := cl.tokenContract.BalanceOf(&bind.CallOpts{}, account)
+	if err != nil {
+		log.Printf("Failed to get token balance: %v", err)
+		return nil, err
+	}
+	balance.Add(balance, amount)
+	return map[common.Hash]common.Hash{
+		balanceKey(account, slot): common.BigToHash(balance),
+	}, nil
+}
+
+// Get a storage override setting the allowance owner gave the account to
+// amount, as a permit not mined yet would. The slot of the allowance mapping
+// is found by probing.
+func (cl *Claimer) allowanceOverride(owner common.Address, amount *big.Int) (map[common.Hash]common.Hash, error) {
+	slot, err := cl.findAllowanceSlot(owner)
+	if err != nil {
+		return nil, err
+	}
+	return map[common.Hash]common.Hash{
+		allowanceKey(owner, cl.account.address, slot): common.BigToHash(amount),
+	}, nil
+}
+
+// Storage key of account in a mapping at slot
+func balanceKey(account common.Address, slot *big.Int) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(account.Bytes(), 32), common.LeftPadBytes(slot.Bytes(), 32))
+}
+
+// Storage key of owner and spender in a nested mapping at slot
+func allowanceKey(owner common.Address, spender common.Address, slot *big.Int) common.Hash {
+	inner := balanceKey(owner, slot)
+	return crypto.Keccak256Hash(common.LeftPadBytes(spender.Bytes(), 32), inner[:])
+}
+
+// Find the storage slot of the token balance mapping by overriding candidate
+// slots and checking which one balanceOf reads. The ARB token keeps it at
+// slot 51, after the storage gap of its upgradeable base contracts.
+func (cl *Claimer) findBalanceSlot() (*big.Int, error) {
+	return cl.probeSlot(&balanceSlots, 51, "balanceOf", func(slot *big.Int) common.Hash {
+		return balanceKey(cl.account.address, slot)
+	}, cl.account.address)
+}
+
+// Find the storage slot of the allowance mapping the same way, through
+// allowance. The ARB token keeps it at slot 52, right after the balances.
+func (cl *Claimer) findAllowanceSlot(owner common.Address) (*big.Int, error) {
+	return cl.probeSlot(&allowanceSlots, 52, "allowance", func(slot *big.Int) common.Hash {
+		return allowanceKey(owner, cl.account.address, slot)
+	}, owner, cl.account.address)
+}
+
+// Override the storage key of each candidate slot, first the likely one,
+// until the token view method reads the probe value back
+func (cl *Claimer) probeSlot(cache *sync.Map, likely int64, method string, key func(*big.Int) common.Hash, args ...interface{}) (*big.Int, error) {
+	if slot, ok := cache.Load(cl.tokenAddress); ok {
+		return slot.(*big.Int), nil
+	}
+
+	parsed, err := token.TokenMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	data, err := parsed.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	probe := common.HexToHash("0xd1e5e1")
+	client := gethclient.New(cl.chain.RPC())
+
+	candidates := []int64{likely}
+	for i := int64(0); i < 100; i++ {
+		if i != likely {
+			candidates = append(candidates, i)
+		}
+	}
+	for _, candidate := range candidates {
+		slot := big.NewInt(candidate)
+		overrides := map[common.Address]gethclient.OverrideAccount{
+			cl.tokenAddress: {StateDiff: map[common.Hash]common.Hash{key(slot): probe}},
+		}
+		out, err := client.CallContract(context.Background(), ethereum.CallMsg{To: &cl.tokenAddress, Data: data}, nil, &overrides)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(out, probe[:]) {
+			cache.Store(cl.tokenAddress, slot)
+			return slot, nil
+		}
+	}
+	return nil, fmt.Errorf("token %s slot not found", method)
+}
+
+// Report a simulated transaction the way confirm reports a mined one
+func (ex *Executor) simulatedOutcome(hash string) (*TxOutcome, error) {
+	sim, ok := ex.dryRun.lookup(common.HexToHash(hash))
+	if !ok {
+		return nil, fmt.Errorf("dry run: no simulation of %s", hash)
+	}
+	outcome := &TxOutcome{
+		Hash:      sim.Hash,
+		GasUsed:   sim.GasEstimate,
+		Success:   sim.Err == nil,
+		Claimed:   sim.Claimed,
+		Transfers: sim.Transfers,
+	}
+	if sim.Err != nil {
+		return outcome, fmt.Errorf("%w %s (dry run): %w", errTxReverted, hash, sim.Err)
+	}
+	return outcome, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// EIP-712 domain of the token, OpenZeppelin's EIP712 with version "1"
+var eip712DomainType = []apitypes.Type{
+	{Name: "name", Type: "string"},
+	{Name: "version", Type: "string"},
+	{Name: "chainId", Type: "uint256"},
+	{Name: "verifyingContract", Type: "address"},
+}
+
+// Delegation struct of ERC20Votes, signed for delegateBySig
+var delegationType = []apitypes.Type{
+	{Name: "delegatee", Type: "address"},
+	{Name: "nonce", Type: "uint256"},
+	{Name: "expiry", Type: "uint256"},
+}
+
+// EIP-2612 Permit struct
+var permitType = []apitypes.Type{
+	{Name: "owner", Type: "address"},
+	{Name: "spender", Type: "address"},
+	{Name: "value", Type: "uint256"},
+	{Name: "nonce", Type: "uint256"},
+	{Name: "deadline", Type: "uint256"},
+}
+
+// How long a permit stays valid. Permits are signed right before the
+// relayer submits them.
+const permitValidity = time.Hour
+
+// How long a delegation signature stays valid. Signatures are made before
+// waiting for the claim window, so this has to cover the wait.
+const delegationValidity = 30 * 24 * time.Hour
+
+// Signature is an ECDSA signature split the way contracts take it
+type Signature struct {
+	V uint8
+	R [32]byte
+	S [32]byte
+}
+
+// Get the EIP-712 domain of the token. It is rebuilt from the token name and
+// checked against DOMAIN_SEPARATOR, so a remote signer shows the user what
+// the contract will verify.
+func (cl *Claimer) tokenDomain() (apitypes.TypedDataDomain, error) {
+	name, err := cl.tokenContract.Name(&bind.CallOpts{})
+	if err != nil {
+		log.Printf("Failed to get token name: %v", err)
+		return apitypes.TypedDataDomain{}, err
+	}
+	separator, err := cl.tokenContract.DOMAINSEPARATOR(&bind.CallOpts{})
+	if err != nil {
+		log.Printf("Failed to get domain separator: %v", err)
+		return apitypes.TypedDataDomain{}, err
+	}
+
+	domain := apitypes.TypedDataDomain{
+		Name:              name,
+		Version:           "1",
+		ChainId:           (*math.HexOrDecimal256)(cl.chain.ChainID),
+		VerifyingContract: cl.tokenAddress.Hex(),
+	}
+	data := apitypes.TypedData{Types: apitypes.Types{"EIP712Domain": eip712DomainType}, Domain: domain}
+	hash, err := data.HashStruct("EIP712Domain", domain.Map())
+	if err != nil {
+		return apitypes.TypedDataDomain{}, err
+	}
+	if common.BytesToHash(hash) != separator {
+		return apitypes.TypedDataDomain{}, fmt.Errorf("domain separator of %s is not the one of %q version 1", cl.tokenAddress.Hex(), name)
+	}
+	return domain, nil
+}
+
+// Sign EIP-712 typed data through the signer of the account
+func (ex *Executor) signTypedData(data apitypes.TypedData) (*Signature, error) {
+	sig, err := ex.account.signer.SignTypedData(context.Background(), data)
+	if err != nil {
+		log.Printf("Failed to sign %s: %v", data.PrimaryType, err)
+		return nil, err
+	}
+	out := &Signature{V: sig[64]}
+	copy(out.R[:], sig[:32])
+	copy(out.S[:], sig[32:64])
+	return out, nil
+}
+
+// Sign a delegation of the account's voting power to delegatee, valid until
+// expiry, at the current token nonce of the account
+func (cl *Claimer) signDelegation(delegatee common.Address, expiry *big.Int) (*Signature, *big.Int, error) {
+	nonce, err := cl.tokenContract.Nonces(&bind.CallOpts{}, cl.account.address)
+	if err != nil {
+		log.Printf("Failed to get token nonce: %v", err)
+		return nil, nil, err
+	}
+	sig, err := cl.signDelegationAt(delegatee, nonce, expiry)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sig, nonce, nil
+}
+
+// Sign a delegation to delegatee at a given token nonce
+func (cl *Claimer) signDelegationAt(delegatee common.Address, nonce *big.Int, expiry *big.Int) (*Signature, error) {
+	domain, err := cl.tokenDomain()
+	if err != nil {
+		return nil, err
+	}
+	return cl.signTypedData(delegationData(domain, delegatee, nonce, expiry))
+}
+
+// Build the typed data of a Delegation in the domain of the token
+func delegationData(domain apitypes.TypedDataDomain, delegatee common.Address, nonce *big.Int, expiry *big.Int) apitypes.TypedData {
+	return apitypes.TypedData{
+		Types:       apitypes.Types{"EIP712Domain": eip712DomainType, "Delegation": delegationType},
+		PrimaryType: "Delegation",
+		Domain:      domain,
+		Message: apitypes.TypedDataMessage{
+			"delegatee": delegatee.Hex(),
+			"nonce":     nonce.String(),
+			"expiry":    expiry.String(),
+		},
+	}
+}
+
+// Recover the address that signed typed data
+func recoverTypedData(data apitypes.TypedData, sig *Signature) (common.Address, error) {
+	digest, _, err := apitypes.TypedDataAndHash(data)
+	if err != nil {
+		return common.Address{}, err
+	}
+	rsv := make([]byte, 65)
+	copy(rsv, sig.R[:])
+	copy(rsv[32:], sig.S[:])
+	rsv[64] = sig.V
+	if rsv[64] >= 27 {
+		rsv[64] -= 27
+	}
+	pub, err := crypto.SigToPub(digest, rsv)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// Sign an EIP-2612 permit letting spender move value tokens of the account
+// until deadline, at the current token nonce of the account
+func (cl *Claimer) signPermit(spender common.Address, value *big.Int, deadline *big.Int) (*Signature, error) {
+	domain, err := cl.tokenDomain()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := cl.tokenContract.Nonces(&bind.CallOpts{}, cl.account.address)
+	if err != nil {
+		log.Printf("Failed to get token nonce: %v", err)
+		return nil, err
+	}
+
+	return cl.signTypedData(apitypes.TypedData{
+		Types:       apitypes.Types{"EIP712Domain": eip712DomainType, "Permit": permitType},
+		PrimaryType: "Permit",
+		Domain:      domain,
+		Message: apitypes.TypedDataMessage{
+			"owner":    cl.account.address.Hex(),
+			"spender":  spender.Hex(),
+			"value":    value.String(),
+			"nonce":    nonce.String(),
+			"deadline": deadline.String(),
+		},
+	})
+}
+
+// Expiry of a delegation signature made now
+func delegationExpiry() *big.Int {
+	return big.NewInt(time.Now().Add(delegationValidity).Unix())
+}
@@ -5,44 +5,58 @@ import (
 	"crypto/ecdsa"
 	"log"
 	"math/big"
+	"sync/atomic"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 type Chain struct {
-	Client  *ethclient.Client
+	pool    *RPCPool
+	ws      *ethclient.Client // optional, used for subscriptions
+	Network *Network
 	ChainID *big.Int
-	Signer  types.Signer
-}
 
-func NewChain(url string) (*Chain, error) {
-	client, err := ethclient.Dial(url)
-	if err != nil {
-		log.Printf("Failed to connect to the Ethereum client: %v", err)
-		return nil, err
-	}
+	noNodeInterface atomic.Bool // gas is estimated without NodeInterface
+}
 
-	chainID, err := client.NetworkID(context.Background())
+// NewChain connects to one or more RPC endpoints of the given network.
+// Endpoints reporting another chain ID are never used, and when none is on
+// the expected chain nothing gets signed at all.
+func NewChain(network *Network, urls ...string) (*Chain, error) {
+	pool, err := dialPool(network.ChainID, urls)
 	if err != nil {
-		log.Printf("Failed to get chain ID: %v", err)
+		log.Printf("Failed to connect to %s: %v", network.Name, err)
 		return nil, err
 	}
 
-	signer := types.NewEIP155Signer(chainID)
+	go pool.monitor(context.Background(), 10*time.Second)
 
 	return &Chain{
-		Client:  client,
-		ChainID: chainID,
-		Signer:  signer,
+		pool:    pool,
+		Network: network,
+		ChainID: network.ChainID,
 	}, nil
 }
 
+// Client returns the client of the fastest healthy endpoint
+func (c *Chain) Client() *ethclient.Client {
+	return c.pool.best().Client
+}
+
+// RPC returns the raw RPC client of the fastest healthy endpoint
+func (c *Chain) RPC() *rpc.Client {
+	return c.pool.best().RPC
+}
+
+// Account is an address and the signer holding its key
 type Account struct {
-	privateKey *ecdsa.PrivateKey
-	address    common.Address
+	signer  Signer
+	address common.Address
 }
 
 func NewAccount(initialPrv string) (*Account, error) {
@@ -51,42 +65,54 @@ func NewAccount(initialPrv string) (*Account, error) {
 		log.Printf("Failed to get private key: %v", err)
 		return nil, err
 	}
+	return newKeyAccount(privateKey), nil
+}
 
-	// get address from private key
-	address := crypto.PubkeyToAddress(privateKey.PublicKey)
+// Wrap a private key held in memory into an Account
+func newKeyAccount(privateKey *ecdsa.PrivateKey) *Account {
+	signer := newKeySigner(privateKey)
+	return &Account{
+		signer:  signer,
+		address: signer.Address(),
+	}
+}
 
+// NewRemoteAccount uses an account whose key is kept by a Clef compatible
+// signer at url
+func NewRemoteAccount(url string, address common.Address) (*Account, error) {
+	signer, err := newRemoteSigner(url, address)
+	if err != nil {
+		return nil, err
+	}
 	return &Account{
-		privateKey: privateKey,
-		address:    address,
+		signer:  signer,
+		address: address,
 	}, nil
 }
 
 type Executor struct {
 	account *Account
 	chain   *Chain
+	fees    *FeePolicy
+	nonces  *NonceManager
+	dryRun  *DryRun  // simulate instead of sending when set
+	journal *Journal // records every transaction sent, if set
 }
 
-// NewExecutor creates a new Executor instance
-func NewExecutor(url string, initialPrv string) (*Executor, error) {
-	chain, err := NewChain(url)
-	if err != nil {
-		return nil, err
-	}
-
-	account, err := NewAccount(initialPrv)
-	if err != nil {
-		return nil, err
-	}
-
+// NewExecutorWithChain creates an Executor for an account on an already
+// connected chain, so many accounts can share one connection
+func NewExecutorWithChain(chain *Chain, account *Account) *Executor {
 	return &Executor{
 		account: account,
 		chain:   chain,
-	}, nil
+		fees:    DefaultFeePolicy(),
+		nonces:  &NonceManager{},
+	}
 }
 
 // Client returns the underlying ethclient.Client
 func (ex *Executor) Client() *ethclient.Client {
-	return ex.chain.Client
+	return ex.chain.Client()
 }
 
 // Get nonce of initial address
@@ -100,6 +126,17 @@ func (ex *Executor) getNonce() (uint64, error) {
 	return nonce, nil
 }
 
+// Get ETH balance of initial address
+func (ex *Executor) ethBalance() (*big.Int, error) {
+	client := ex.Client()
+	balance, err := client.BalanceAt(context.Background(), ex.account.address, nil)
+	if err != nil {
+		log.Printf("Failed to get balance: %v", err)
+		return nil, err
+	}
+	return balance, nil
+}
+
 // Get suggested gas price
 func (ex *Executor) getSuggestedGasPrice() (*big.Int, error) {
 	client := ex.Client()
@@ -111,33 +148,18 @@ func (ex *Executor) getSuggestedGasPrice() (*big.Int, error) {
 	return gasPrice, nil
 }
 
-// Get constant gas price
-func (ex *Executor) getGasPrice() *big.Int {
-	return big.NewInt(100000001 * 2)
-}
-
-// Transfer amount ETH to address
-func (ex *Executor) transfer2Address(address string, amount int64) (string, error) {
-
-	nonce, err := ex.getNonce()
-	if err != nil {
-		return "", err
-	}
-	destinationAddress := common.HexToAddress(address)
-
-	tx := types.NewTransaction(nonce, destinationAddress, big.NewInt(amount), 210000, ex.getGasPrice(), nil)
-
-	signedTx, err := types.SignTx(tx, ex.chain.Signer, ex.account.privateKey)
-	if err != nil {
-		log.Printf("Failed to sign transaction: %v", err)
-		return "", err
+// Send a signed transaction and return its hash
+func (ex *Executor) sendTx(signedTx *types.Transaction) (string, error) {
+	if ex.dryRun != nil {
+		return ex.recordSimulation(ex.simulate(signedTx, nil))
 	}
-
-	client := ex.Client()
-	err = client.SendTransaction(context.Background(), signedTx)
+	ex.journalTx(signedTx)
+	err := ex.chain.SendTransaction(context.Background(), signedTx)
 	if err != nil {
 		log.Printf("Failed to send transaction: %v", err)
-		return "", err
+		ex.journalStatus(signedTx.Hash(), txRejected, 0, err)
+		return "", wrapRevert(err)
 	}
+	ex.journalStatus(signedTx.Hash(), txSent, 0, nil)
 	return signedTx.Hash().Hex(), nil
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+)
+
+// FeePolicy describes how EIP-1559 fee caps are derived from the base fee
+// of the latest block.
+type FeePolicy struct {
+	TipCap            *big.Int // max priority fee per gas, in wei
+	MaxFeeCap         *big.Int // upper bound for max fee per gas, in wei; nil means unbounded
+	BaseFeeMultiplier int64    // headroom over the current base fee
+
+	BumpPercent     int64         // fee increase of a replacement, at least minBumpPercent
+	ReplaceAfter    time.Duration // speed up a transaction not mined after this long; 0 never does
+	MaxReplacements int           // speed-ups of one transaction before giving up
+
+	GasMultiplier float64 // headroom over the gas estimate
+	GasCeiling    uint64  // highest gas limit, also used when estimation fails
+}
+
+// DefaultFeePolicy returns the policy used when nothing is configured.
+// Arbitrum ignores the priority fee, so the tip defaults to zero.
+func DefaultFeePolicy() *FeePolicy {
+	return &FeePolicy{
+		TipCap:            big.NewInt(0),
+		BaseFeeMultiplier: 2,
+		BumpPercent:       minBumpPercent,
+		MaxReplacements:   3,
+		GasMultiplier:     1.2,
+		GasCeiling:        2000000,
+	}
+}
+
+// Fees holds the caps used for a single dynamic fee transaction
+type Fees struct {
+	BaseFee *big.Int
+	TipCap  *big.Int
+	FeeCap  *big.Int
+}
+
+// Get fee caps from the latest header and the fee policy
+func (ex *Executor) getFees() (*Fees, error) {
+	client := ex.Client()
+	header, err := client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		log.Printf("Failed to get latest header: %v", err)
+		return nil, err
+	}
+
+	baseFee := header.BaseFee
+	if baseFee == nil {
+		// pre-London node, fall back to the legacy gas price as the base fee
+		baseFee, err = ex.getSuggestedGasPrice()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	policy := ex.feePolicy()
+	tipCap := new(big.Int).Set(policy.TipCap)
+	feeCap := new(big.Int).Mul(baseFee, big.NewInt(policy.BaseFeeMultiplier))
+	feeCap.Add(feeCap, tipCap)
+
+	if policy.MaxFeeCap != nil && feeCap.Cmp(policy.MaxFeeCap) > 0 {
+		if policy.MaxFeeCap.Cmp(baseFee) < 0 {
+			err := fmt.Errorf("base fee %v exceeds max fee cap %v", baseFee, policy.MaxFeeCap)
+			log.Printf("Failed to get fees: %v", err)
+			return nil, err
+		}
+		feeCap.Set(policy.MaxFeeCap)
+	}
+	if tipCap.Cmp(feeCap) > 0 {
+		tipCap.Set(feeCap)
+	}
+
+	return &Fees{
+		BaseFee: baseFee,
+		TipCap:  tipCap,
+		FeeCap:  feeCap,
+	}, nil
+}
+
+// Get the fee policy of the executor, or the default one
+func (ex *Executor) feePolicy() *FeePolicy {
+	if ex.fees == nil {
+		return DefaultFeePolicy()
+	}
+	return ex.fees
+}
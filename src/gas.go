@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+)
+
+// ArbOS NodeInterface, a virtual contract answering eth_call only
+var nodeInterfaceAddress = common.HexToAddress("0x00000000000000000000000000000000000000C8")
+
+const nodeInterfaceABI = `[{"type":"function","name":"gasEstimateComponents","stateMutability":"payable",
+"inputs":[{"name":"to","type":"address"},{"name":"contractCreation","type":"bool"},{"name":"data","type":"bytes"}],
+"outputs":[{"name":"gasEstimate","type":"uint64"},{"name":"gasEstimateForL1","type":"uint64"},{"name":"baseFee","type":"uint256"},{"name":"l1BaseFeeEstimate","type":"uint256"}]}]`
+
+var nodeInterface = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(nodeInterfaceABI))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// Estimate the gas of a call including the L1 calldata component Arbitrum
+// charges as gas. NodeInterface reports both parts; chains without it, and
+// calls needing state overrides, fall back to eth_estimateGas.
+func (ex *Executor) estimateTotalGas(ctx context.Context, msg ethereum.CallMsg, overrides map[common.Address]gethclient.OverrideAccount) (uint64, error) {
+	if len(overrides) == 0 && !ex.chain.noNodeInterface.Load() {
+		total, l1, err := ex.gasEstimateComponents(ctx, msg)
+		if err == nil {
+			log.Printf("Gas estimate of %s: %d, of which %d for L1 calldata", describeCall(msg.Data), total, l1)
+			return total, nil
+		}
+		gas, err2 := ex.estimateGas(ctx, msg, nil)
+		if err2 == nil {
+			// the call is fine, so the chain has no NodeInterface
+			log.Printf("NodeInterface not available, using eth_estimateGas: %v", err)
+			ex.chain.noNodeInterface.Store(true)
+		}
+		return gas, err2
+	}
+	return ex.estimateGas(ctx, msg, overrides)
+}
+
+// Call NodeInterface.gasEstimateComponents for msg, returning the total gas
+// and the part of it paying for L1 calldata
+func (ex *Executor) gasEstimateComponents(ctx context.Context, msg ethereum.CallMsg) (uint64, uint64, error) {
+	to := common.Address{}
+	if msg.To != nil {
+		to = *msg.To
+	}
+	data, err := nodeInterface.Pack("gasEstimateComponents", to, msg.To == nil, msg.Data)
+	if err != nil {
+		return 0, 0, err
+	}
+	out, err := ex.chain.CallContract(ctx, ethereum.CallMsg{
+		From:  msg.From,
+		To:    &nodeInterfaceAddress,
+		Value: msg.Value,
+		Data:  data,
+	}, nil)
+	if err != nil {
+		return 0, 0, wrapRevert(err)
+	}
+	res, err := nodeInterface.Unpack("gasEstimateComponents", out)
+	if err != nil {
+		return 0, 0, err
+	}
+	return res[0].(uint64), res[1].(uint64), nil
+}
+
+// Get the gas limit for a call: the estimate times the multiplier of the
+// fee policy, at most its ceiling. A call that reverts is not signed, unless
+// it is estimated on overridden state for a pre-signed transaction and the
+// revert is not a permanent one; then, like when the node fails to
+// estimate, the ceiling is used so the transaction still goes out.
+func (ex *Executor) gasLimit(msg ethereum.CallMsg, overrides map[common.Address]gethclient.OverrideAccount) (uint64, error) {
+	policy := ex.feePolicy()
+	msg.From = ex.account.address
+	estimate, err := ex.estimateTotalGas(context.Background(), msg, overrides)
+	if err != nil {
+		err = wrapRevert(err)
+		var revert *RevertError
+		if errors.As(err, &revert) && (len(overrides) == 0 || isPermanent(err)) {
+			log.Printf("Failed to estimate gas of %s: %v", describeCall(msg.Data), err)
+			return 0, err
+		}
+		log.Printf("Failed to estimate gas of %s, using the ceiling of %d: %v", describeCall(msg.Data), policy.GasCeiling, err)
+		return policy.GasCeiling, nil
+	}
+	if estimate > policy.GasCeiling {
+		err := fmt.Errorf("gas estimate %d of %s exceeds the ceiling of %d", estimate, describeCall(msg.Data), policy.GasCeiling)
+		log.Printf("Failed to get gas limit: %v", err)
+		return 0, err
+	}
+	limit := uint64(math.Ceil(float64(estimate) * policy.GasMultiplier))
+	if limit > policy.GasCeiling {
+		limit = policy.GasCeiling
+	}
+	return limit, nil
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Pick the delegate of a wallet: the command line first, then the wallet
+// entry, then the profile
+func (c *cliContext) delegateeOf(w *Wallet, override string) (common.Address, error) {
+	switch {
+	case override != "":
+		if !common.IsHexAddress(override) || isZeroAddress(override) {
+			return common.Address{}, fmt.Errorf("-to: invalid address %q", override)
+		}
+		return common.HexToAddress(override), nil
+	case w.Delegate != "":
+		return common.HexToAddress(w.Delegate), nil
+	case c.settings.Pipeline.Delegate != (common.Address{}):
+		return c.settings.Pipeline.Delegate, nil
+	}
+	return common.Address{}, errors.New("no delegate: use -to, or set delegate for the wallet or profile")
+}
+
+func cmdDelegate(args []string) error {
+	fs := flag.NewFlagSet("delegate", flag.ExitOnError)
+	to := fs.String("to", "", "address to delegate voting power to, overrides the wallets")
+	c, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	claimers, wallets, err := c.claimers()
+	if err != nil {
+		return err
+	}
+	delegatees := map[*Claimer]common.Address{}
+	for i, cl := range claimers {
+		delegatee, err := c.delegateeOf(wallets[i], *to)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cl.account.address.Hex(), err)
+		}
+		delegatees[cl] = delegatee
+	}
+
+	return c.forEachWallet(claimers, func(cl *Claimer, r *txReport) error {
+		current, err := cl.tokenContract.Delegates(&bind.CallOpts{}, cl.account.address)
+		if err != nil {
+			return err
+		}
+		if current == delegatees[cl] {
+			// delegating again only burns gas
+			return nil
+		}
+		call, err := cl.delegateCall(delegatees[cl])
+		if err != nil {
+			return err
+		}
+		var outcome *TxOutcome
+		r.Tx, outcome, err = cl.Submit(c.ctx, call, c.settings.Pipeline.ReceiptTimeout)
+		if outcome != nil {
+			r.Block = outcome.Block
+		}
+		return err
+	})
+}
+
+// DelegationSignature holds the arguments of delegateBySig, so a relayer can
+// delegate for a wallet and pay the gas
+type DelegationSignature struct {
+	Delegator common.Address `json:"delegator"`
+	Delegatee common.Address `json:"delegatee"`
+	Nonce     *hexutil.Big   `json:"nonce"`
+	Expiry    *hexutil.Big   `json:"expiry"`
+	V         uint8          `json:"v"`
+	R         hexutil.Bytes  `json:"r"`
+	S         hexutil.Bytes  `json:"s"`
+}
+
+func cmdDelegateSign(args []string) error {
+	fs := flag.NewFlagSet("delegate-sign", flag.ExitOnError)
+	to := fs.String("to", "", "address to delegate voting power to, overrides the wallets")
+	valid := fs.Duration("valid", delegationValidity, "how long the signatures stay valid")
+	out := fs.String("out", "", "file to write the signatures to, stdout when empty")
+	c, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	claimers, wallets, err := c.claimers()
+	if err != nil {
+		return err
+	}
+
+	expiry := big.NewInt(time.Now().Add(*valid).Unix())
+	sigs := make([]*DelegationSignature, len(claimers))
+	for i, cl := range claimers {
+		delegatee, err := c.delegateeOf(wallets[i], *to)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cl.account.address.Hex(), err)
+		}
+		sig, nonce, err := cl.signDelegation(delegatee, expiry)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cl.account.address.Hex(), err)
+		}
+		sigs[i] = &DelegationSignature{
+			Delegator: cl.account.address,
+			Delegatee: delegatee,
+			Nonce:     (*hexutil.Big)(nonce),
+			Expiry:    (*hexutil.Big)(expiry),
+			V:         sig.V,
+			R:         sig.R[:],
+			S:         sig.S[:],
+		}
+	}
+
+	data, err := json.MarshalIndent(sigs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		fmt.Println(string(data))
+		return nil
+	}
+	return os.WriteFile(*out, append(data, '\n'), 0600)
+}
+
+// Check a delegation signature before paying gas to submit it
+func (cl *Claimer) checkDelegation(d *DelegationSignature) error {
+	if len(d.R) != 32 || len(d.S) != 32 || d.Nonce == nil || d.Expiry == nil {
+		return errors.New("malformed signature")
+	}
+	if d.Expiry.ToInt().Int64() < time.Now().Unix() {
+		return errors.New("signature expired")
+	}
+	nonce, err := cl.tokenContract.Nonces(&bind.CallOpts{}, d.Delegator)
+	if err != nil {
+		return err
+	}
+	if nonce.Cmp(d.Nonce.ToInt()) != 0 {
+		return fmt.Errorf("signed at nonce %v, token nonce is %v", d.Nonce.ToInt(), nonce)
+	}
+
+	// delegateBySig delegates for whoever the signature recovers to
+	domain, err := cl.tokenDomain()
+	if err != nil {
+		return err
+	}
+	sig := &Signature{V: d.V}
+	copy(sig.R[:], d.R)
+	copy(sig.S[:], d.S)
+	signer, err := recoverTypedData(delegationData(domain, d.Delegatee, d.Nonce.ToInt(), d.Expiry.ToInt()), sig)
+	if err != nil {
+		return err
+	}
+	if signer != d.Delegator {
+		return fmt.Errorf("signed by %s, not by the delegator", signer.Hex())
+	}
+	return nil
+}
+
+// Check that a relayed delegation took effect
+func (cl *Claimer) checkDelegated(d *DelegationSignature) error {
+	if cl.dryRun != nil {
+		return nil
+	}
+	current, err := cl.tokenContract.Delegates(&bind.CallOpts{}, d.Delegator)
+	if err != nil {
+		log.Printf("Failed to get delegate: %v", err)
+		return err
+	}
+	if current != d.Delegatee {
+		return fmt.Errorf("delegates to %s after the transaction, not to %s", current.Hex(), d.Delegatee.Hex())
+	}
+	return nil
+}
+
+func cmdDelegateRelay(args []string) error {
+	fs := flag.NewFlagSet("delegate-relay", flag.ExitOnError)
+	file := fs.String("signatures", "", "file written by delegate-sign")
+	c, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	var sigs []*DelegationSignature
+	if err := json.Unmarshal(data, &sigs); err != nil {
+		return fmt.Errorf("%s: %w", *file, err)
+	}
+	relayer, err := c.relayer()
+	if err != nil {
+		return err
+	}
+
+	// one relayer account, so submit one after the other
+	reports := make([]txReport, len(sigs))
+	failed := false
+	for i, d := range sigs {
+		r := &reports[i]
+		r.Address = d.Delegator.Hex()
+		err := func() error {
+			if err := relayer.checkDelegation(d); err != nil {
+				return err
+			}
+			call, err := relayer.delegateBySigCall(d)
+			if err != nil {
+				return err
+			}
+			var outcome *TxOutcome
+			r.Tx, outcome, err = relayer.Submit(c.ctx, call, c.settings.Pipeline.ReceiptTimeout)
+			if outcome != nil {
+				r.Block = outcome.Block
+			}
+			if err != nil {
+				return err
+			}
+			return relayer.checkDelegated(d)
+		}()
+		if err != nil {
+			r.Error = err.Error()
+			failed = true
+		}
+	}
+
+	c.print(reports, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "DELEGATOR\tTX\tBLOCK\tERROR")
+		for _, r := range reports {
+			block := "-"
+			if r.Block != 0 {
+				block = fmt.Sprint(r.Block)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Address, orDash(r.Tx), block, orDash(r.Error))
+		}
+	})
+	c.printDryRun()
+	if failed {
+		return errSomeFailed
+	}
+	return nil
+}
+
+// Parse a comma separated list of block numbers
+func parseBlocks(list string) ([]uint64, error) {
+	var blocks []uint64
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block %q", s)
+		}
+		blocks = append(blocks, n)
+	}
+	return blocks, nil
+}
+
+// Get the votes of account now and at each of blocks
+func (cl *Claimer) votes(account common.Address, blocks []uint64) (*big.Int, []*big.Int, error) {
+	current, err := cl.tokenContract.GetVotes(&bind.CallOpts{}, account)
+	if err != nil {
+		return nil, nil, err
+	}
+	past := make([]*big.Int, len(blocks))
+	for i, block := range blocks {
+		past[i], err = cl.tokenContract.GetPastVotes(&bind.CallOpts{}, account, new(big.Int).SetUint64(block))
+		if err != nil {
+			return nil, nil, fmt.Errorf("votes at block %d: %w", block, err)
+		}
+	}
+	return current, past, nil
+}
+
+// votes reports voting power per wallet and per delegate. Block numbers are
+// the ones seen by the token, which on Arbitrum are L1 block numbers.
+func cmdVotes(args []string) error {
+	fs := flag.NewFlagSet("votes", flag.ExitOnError)
+	at := fs.String("at", "", "comma separated past block numbers to report voting power at")
+	c, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	blocks, err := parseBlocks(*at)
+	if err != nil {
+		return fmt.Errorf("-at: %w", err)
+	}
+	claimers, _, err := c.claimers()
+	if err != nil {
+		return err
+	}
+	decimals, err := claimers[0].tokenDecimals()
+	if err != nil {
+		return err
+	}
+	format := func(amounts []*big.Int) []string {
+		out := make([]string, len(amounts))
+		for i, amount := range amounts {
+			out[i] = formatUnits(amount, decimals)
+		}
+		return out
+	}
+
+	type walletVotes struct {
+		Address   string   `json:"address"`
+		Balance   string   `json:"balance"`
+		Delegate  string   `json:"delegate"`
+		Votes     string   `json:"votes"`
+		PastVotes []string `json:"pastVotes,omitempty"`
+		Error     string   `json:"error,omitempty"`
+	}
+	type delegateVotes struct {
+		Address   string   `json:"address"`
+		Wallets   int      `json:"wallets"`
+		Delegated string   `json:"delegated"` // balance of our wallets delegated to it
+		Votes     string   `json:"votes"`
+		PastVotes []string `json:"pastVotes,omitempty"`
+		Error     string   `json:"error,omitempty"`
+	}
+	report := struct {
+		Blocks    []uint64        `json:"blocks,omitempty"`
+		Wallets   []walletVotes   `json:"wallets"`
+		Delegates []delegateVotes `json:"delegates"`
+	}{
+		Blocks:  blocks,
+		Wallets: make([]walletVotes, len(claimers)),
+	}
+
+	delegated := make([]common.Address, len(claimers))
+	balances := make([]*big.Int, len(claimers))
+	forEach(len(claimers), c.settings.Parallel, func(i int) {
+		cl := claimers[i]
+		wv := walletVotes{Address: cl.account.address.Hex()}
+		defer func() { report.Wallets[i] = wv }()
+
+		balance, err := cl.tokenBalance()
+		if err != nil {
+			wv.Error = err.Error()
+			return
+		}
+		delegatee, err := cl.tokenContract.Delegates(&bind.CallOpts{}, cl.account.address)
+		if err != nil {
+			wv.Error = err.Error()
+			return
+		}
+		current, past, err := cl.votes(cl.account.address, blocks)
+		if err != nil {
+			wv.Error = err.Error()
+			return
+		}
+		delegated[i], balances[i] = delegatee, balance
+		wv.Balance = formatUnits(balance, decimals)
+		wv.Delegate = delegatee.Hex()
+		wv.Votes = formatUnits(current, decimals)
+		wv.PastVotes = format(past)
+	})
+
+	// group our wallets by delegate, undelegated balances count for nobody
+	type group struct {
+		wallets int
+		balance *big.Int
+	}
+	groups := map[common.Address]*group{}
+	for i, delegatee := range delegated {
+		if balances[i] == nil || delegatee == (common.Address{}) {
+			continue
+		}
+		g, ok := groups[delegatee]
+		if !ok {
+			g = &group{balance: new(big.Int)}
+			groups[delegatee] = g
+		}
+		g.wallets++
+		g.balance.Add(g.balance, balances[i])
+	}
+	for delegatee, g := range groups {
+		dv := delegateVotes{Address: delegatee.Hex(), Wallets: g.wallets, Delegated: formatUnits(g.balance, decimals)}
+		current, past, err := claimers[0].votes(delegatee, blocks)
+		if err != nil {
+			dv.Error = err.Error()
+		} else {
+			dv.Votes = formatUnits(current, decimals)
+			dv.PastVotes = format(past)
+		}
+		report.Delegates = append(report.Delegates, dv)
+	}
+	sort.Slice(report.Delegates, func(i, j int) bool {
+		return report.Delegates[i].Address < report.Delegates[j].Address
+	})
+
+	c.print(report, func(w *tabwriter.Writer) {
+		header := func(first string) string {
+			h := first
+			for _, block := range blocks {
+				h += fmt.Sprintf("\tVOTES AT %d", block)
+			}
+			return h
+		}
+		past := func(votes []string) string {
+			s := ""
+			for i := range blocks {
+				v := "-"
+				if i < len(votes) {
+					v = votes[i]
+				}
+				s += "\t" + v
+			}
+			return s
+		}
+		fmt.Fprintln(w, header("WALLET\tBALANCE\tDELEGATE\tVOTES")+"\tERROR")
+		for _, wv := range report.Wallets {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s%s\t%s\n", wv.Address, orDash(wv.Balance), orDash(wv.Delegate),
+				orDash(wv.Votes), past(wv.PastVotes), orDash(wv.Error))
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, header("DELEGATE\tWALLETS\tDELEGATED\tVOTES")+"\tERROR")
+		for _, dv := range report.Delegates {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s%s\t%s\n", dv.Address, dv.Wallets, dv.Delegated,
+				orDash(dv.Votes), past(dv.PastVotes), orDash(dv.Error))
+		}
+	})
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// NewAccountsFromMnemonic derives one Account per index of a BIP-32 path
+// range such as m/44'/60'/0'/0/0..49. A plain path yields a single account.
+func NewAccountsFromMnemonic(mnemonic string, passphrase string, pathRange string) ([]*Account, error) {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		log.Printf("Failed to read mnemonic: %v", err)
+		return nil, err
+	}
+
+	base, from, to, err := parsePathRange(pathRange)
+	if err != nil {
+		return nil, err
+	}
+
+	accs := make([]*Account, 0, to-from+1)
+	for i := uint64(from); i <= uint64(to); i++ {
+		path := append(append(accounts.DerivationPath{}, base...), uint32(i))
+		privateKey, err := deriveKey(seed, path)
+		if err != nil {
+			log.Printf("Failed to derive %s: %v", path, err)
+			return nil, err
+		}
+		accs = append(accs, newKeyAccount(privateKey))
+	}
+	return accs, nil
+}
+
+// Most accounts a single path range may derive
+const maxPathRange = 10000
+
+// Split a path range into the base path and the first and last index of
+// its final component
+func parsePathRange(pathRange string) (accounts.DerivationPath, uint32, uint32, error) {
+	cut := strings.LastIndex(pathRange, "/")
+	if cut < 0 {
+		return nil, 0, 0, fmt.Errorf("invalid derivation path %q", pathRange)
+	}
+	last := pathRange[cut+1:]
+	first, end, isRange := strings.Cut(last, "..")
+	if !isRange {
+		end = first
+	}
+
+	from, err := accounts.ParseDerivationPath(pathRange[:cut+1] + first)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid derivation path %q: %w", pathRange, err)
+	}
+	start := from[len(from)-1]
+	hardened := strings.HasSuffix(first, "'")
+	if hardened != strings.HasSuffix(end, "'") {
+		return nil, 0, 0, fmt.Errorf("invalid derivation path %q: mixed hardened range", pathRange)
+	}
+	stop, err := strconv.ParseUint(strings.TrimSuffix(end, "'"), 10, 31)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid derivation path %q: %w", pathRange, err)
+	}
+	if hardened {
+		stop += 0x80000000
+	}
+	if uint32(stop) < start {
+		return nil, 0, 0, fmt.Errorf("invalid derivation path %q: empty range", pathRange)
+	}
+	if uint64(stop)-uint64(start) >= maxPathRange {
+		return nil, 0, 0, fmt.Errorf("invalid derivation path %q: more than %d accounts", pathRange, maxPathRange)
+	}
+	return from[:len(from)-1], start, uint32(stop), nil
+}
+
+// Derive the private key at path from a BIP-39 seed following BIP-32
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	curveOrder := crypto.S256().Params().N
+
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	key, chainCode := new(big.Int).SetBytes(sum[:32]), sum[32:]
+	if key.Sign() == 0 || key.Cmp(curveOrder) >= 0 {
+		return nil, fmt.Errorf("invalid master key")
+	}
+
+	for _, index := range path {
+		var data []byte
+		if index >= 0x80000000 {
+			data = append([]byte{0}, crypto.FromECDSA(toECDSA(key))...)
+		} else {
+			data = crypto.CompressPubkey(&toECDSA(key).PublicKey)
+		}
+		data = binary.BigEndian.AppendUint32(data, index)
+
+		mac := hmac.New(sha512.New, chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+
+		tweak := new(big.Int).SetBytes(sum[:32])
+		if tweak.Cmp(curveOrder) >= 0 {
+			return nil, fmt.Errorf("invalid child key at index %d", index)
+		}
+		key = tweak.Add(tweak, key).Mod(tweak, curveOrder)
+		if key.Sign() == 0 {
+			return nil, fmt.Errorf("invalid child key at index %d", index)
+		}
+		chainCode = sum[32:]
+	}
+	return toECDSA(key), nil
+}
+
+func toECDSA(key *big.Int) *ecdsa.PrivateKey {
+	privateKey, _ := crypto.ToECDSA(key.FillBytes(make([]byte, 32)))
+	return privateKey
+}
+
+// Read a mnemonic from file, or prompt for it when no file is given
+func readMnemonic(file string) (string, error) {
+	if file == "" {
+		return readSecret("Mnemonic: ")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		log.Printf("Failed to read mnemonic file: %v", err)
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Derive accounts from a mnemonic file, with an optional BIP-39 passphrase file
+func loadMnemonicAccounts(mnemonicFile string, passwordFile string, pathRange string) ([]*Account, error) {
+	mnemonic, err := readMnemonic(mnemonicFile)
+	if err != nil {
+		return nil, err
+	}
+	passphrase := ""
+	if passwordFile != "" {
+		passphrase, err = readPassphrase(passwordFile, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewAccountsFromMnemonic(mnemonic, passphrase, pathRange)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Accounts of the well known development mnemonic of Hardhat and Anvil
+func TestNewAccountsFromMnemonic(t *testing.T) {
+	accs, err := NewAccountsFromMnemonic("test test test test test test test test test test test junk", "", "m/44'/60'/0'/0/0..2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266",
+		"0x70997970C51812dc3A010C7d01b50e0d17dc79C8",
+		"0x3C44CdDdB6a900fa2b585dd299e03d12FA4293BC",
+	}
+	if len(accs) != len(want) {
+		t.Fatalf("got %d accounts, want %d", len(accs), len(want))
+	}
+	for i, acc := range accs {
+		if acc.address != common.HexToAddress(want[i]) {
+			t.Errorf("account %d is %s, want %s", i, acc.address.Hex(), want[i])
+		}
+	}
+}
+
+func TestParsePathRange(t *testing.T) {
+	tests := []struct {
+		path     string
+		from, to uint32
+		err      string
+	}{
+		{"m/44'/60'/0'/0/0", 0, 0, ""},
+		{"m/44'/60'/0'/0/0..49", 0, 49, ""},
+		{"m/44'/60'/0'/0'..2'", 0x80000000, 0x80000002, ""},
+		{"m/44'/60'/0'/0/5..4", 0, 0, "empty range"},
+		{"m/44'/60'/0'/0/0..2'", 0, 0, "mixed hardened"},
+		{"m/44'/60'/0'/0'..2147483647'", 0, 0, "more than"},
+		{"m/44'/60'/0'/0/0..4294967295", 0, 0, "invalid derivation path"},
+	}
+	for _, tt := range tests {
+		_, from, to, err := parsePathRange(tt.path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want one containing %q", tt.path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || from != tt.from || to != tt.to {
+			t.Errorf("%s: got %d..%d, %v, want %d..%d", tt.path, from, to, err, tt.from, tt.to)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Status of a journaled transaction
+const (
+	txSending  = "sending"  // written before the broadcast, may or may not be out
+	txSent     = "sent"     // accepted by at least one endpoint
+	txRejected = "rejected" // refused by every endpoint, never mined
+	txMined    = "mined"
+	txReverted = "reverted"
+	txReplaced = "replaced" // superseded by a sped up or cancelling transaction
+	txDropped  = "dropped"  // never mined, its nonce went to a transaction not in the journal
+)
+
+// JournalEntry is one signed transaction with everything needed to send it
+// again after a restart
+type JournalEntry struct {
+	Hash    common.Hash    `json:"hash"`
+	ChainID *hexutil.Big   `json:"chainId"`
+	From    common.Address `json:"from"`
+	Nonce   uint64         `json:"nonce"`
+	Purpose string         `json:"purpose"`
+	Raw     hexutil.Bytes  `json:"raw"`
+	Status  string         `json:"status"`
+	Block   uint64         `json:"block,omitempty"`
+	Error   string         `json:"error,omitempty"`
+	Created time.Time      `json:"created"`
+	Updated time.Time      `json:"updated"`
+}
+
+// Journal keeps every transaction sent in a JSON file. The file is rewritten
+// through a temporary file and a rename on every change, so a crash leaves
+// either the old or the new version behind.
+type Journal struct {
+	path    string
+	mu      sync.Mutex
+	entries []*JournalEntry
+}
+
+// OpenJournal loads the journal at path, starting an empty one when the file
+// does not exist yet
+func OpenJournal(path string) (*Journal, error) {
+	j := &Journal{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &j.entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return j, nil
+}
+
+// Write the journal to disk, the caller holds mu
+func (j *Journal) save() error {
+	data, err := json.MarshalIndent(j.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), j.path)
+}
+
+// Add a signed transaction about to be broadcast
+func (j *Journal) add(tx *types.Transaction, from common.Address, purpose string) error {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, e := range j.entries {
+		if e.Hash == tx.Hash() {
+			// sent again, e.g. by the scheduler retrying
+			return nil
+		}
+	}
+	now := time.Now()
+	j.entries = append(j.entries, &JournalEntry{
+		Hash:    tx.Hash(),
+		ChainID: (*hexutil.Big)(tx.ChainId()),
+		From:    from,
+		Nonce:   tx.Nonce(),
+		Purpose: purpose,
+		Raw:     raw,
+		Status:  txSending,
+		Created: now,
+		Updated: now,
+	})
+	return j.save()
+}
+
+// Change the status of a transaction
+func (j *Journal) update(hash common.Hash, status string, block uint64, txErr error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, e := range j.entries {
+		if e.Hash != hash {
+			continue
+		}
+		e.Status = status
+		e.Block = block
+		e.Error = errString(txErr)
+		e.Updated = time.Now()
+		return j.save()
+	}
+	return nil
+}
+
+// Get the entries of an account on a chain, oldest first
+func (j *Journal) entriesOf(chainID *big.Int, from common.Address) []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var out []JournalEntry
+	for _, e := range j.entries {
+		if e.From == from && e.ChainID != nil && e.ChainID.ToInt().Cmp(chainID) == 0 {
+			out = append(out, *e)
+		}
+	}
+	return out
+}
+
+// Get the entry of a transaction, nil when it is not in the journal
+func (j *Journal) entry(hash common.Hash) *JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, e := range j.entries {
+		if e.Hash == hash {
+			out := *e
+			return &out
+		}
+	}
+	return nil
+}
+
+// Record a transaction in the journal before it is broadcast. Journal
+// failures are logged, they never stop a send.
+func (ex *Executor) journalTx(tx *types.Transaction) {
+	if ex.journal == nil {
+		return
+	}
+	if err := ex.journal.add(tx, ex.account.address, describeTx(tx)); err != nil {
+		log.Printf("Failed to write journal: %v", err)
+	}
+}
+
+// Record the new status of a journaled transaction
+func (ex *Executor) journalStatus(hash common.Hash, status string, block uint64, txErr error) {
+	if ex.journal == nil {
+		return
+	}
+	if err := ex.journal.update(hash, status, block, txErr); err != nil {
+		log.Printf("Failed to write journal: %v", err)
+	}
+}
+
+// Name what a transaction does, for the journal and the dry run report
+func describeTx(tx *types.Transaction) string {
+	if len(tx.Data()) == 0 {
+		return "transfer ETH"
+	}
+	return describeCall(tx.Data())
+}
+
+// Send again every transaction of the account that was on its way out when
+// the last run stopped. Ones whose nonce is already used are settled from
+// their receipts instead.
+func (ex *Executor) rebroadcastPending(ctx context.Context) {
+	if ex.journal == nil {
+		return
+	}
+	var nonce uint64
+	nonceKnown := false
+	for _, e := range ex.journal.entriesOf(ex.chain.ChainID, ex.account.address) {
+		if e.Status != txSending && e.Status != txSent {
+			continue
+		}
+		if !nonceKnown {
+			n, err := ex.Client().NonceAt(ctx, ex.account.address, nil)
+			if err != nil {
+				log.Printf("Failed to get nonce: %v", err)
+				return
+			}
+			nonce, nonceKnown = n, true
+		}
+		if e.Nonce < nonce {
+			ex.settle(ctx, e)
+			continue
+		}
+		tx, err := e.transaction()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		log.Printf("Rebroadcasting %s %s at nonce %d", e.Purpose, e.Hash.Hex(), e.Nonce)
+		if err := ex.chain.SendTransaction(ctx, tx); err != nil {
+			// a nonce error only says some transaction has the nonce now
+			log.Printf("Failed to rebroadcast %s: %v", e.Hash.Hex(), err)
+			continue
+		}
+		ex.journalStatus(e.Hash, txSent, 0, nil)
+	}
+}
+
+// Settle a journaled transaction whose nonce is used: record its receipt,
+// or mark it replaced when a competing transaction of the journal was mined
+// and dropped when none was, so no run waits for it again
+func (ex *Executor) settle(ctx context.Context, e JournalEntry) {
+	for _, hash := range ex.competing(e.Hash) {
+		receipt, err := ex.Client().TransactionReceipt(ctx, hash)
+		if errors.Is(err, ethereum.NotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to get receipt of %s: %v", hash.Hex(), err)
+			return
+		}
+		switch {
+		case hash != e.Hash:
+			ex.journalStatus(e.Hash, txReplaced, 0, nil)
+		case receipt.Status == types.ReceiptStatusSuccessful:
+			ex.journalStatus(e.Hash, txMined, receipt.BlockNumber.Uint64(), nil)
+		default:
+			ex.journalStatus(e.Hash, txReverted, receipt.BlockNumber.Uint64(), nil)
+		}
+		return
+	}
+	log.Printf("%s %s was never mined, nonce %d went to another transaction", e.Purpose, e.Hash.Hex(), e.Nonce)
+	ex.journalStatus(e.Hash, txDropped, 0, nil)
+}
+
+// Find the latest journaled transaction of the account for one of purposes
+// that is not known to have failed or been replaced, and created after since
+func (ex *Executor) journaled(since time.Time, purposes ...string) *JournalEntry {
+	if ex.journal == nil {
+		return nil
+	}
+	entries := ex.journal.entriesOf(ex.chain.ChainID, ex.account.address)
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Created.Before(since) || e.Status == txRejected || e.Status == txReverted || e.Status == txReplaced || e.Status == txDropped {
+			continue
+		}
+		for _, p := range purposes {
+			if e.Purpose == p {
+				return &e
+			}
+		}
+	}
+	return nil
+}
+
+// Decode the signed transaction of a journal entry
+func (e *JournalEntry) transaction() (*types.Transaction, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(e.Raw); err != nil {
+		return nil, fmt.Errorf("journal entry %s is corrupt: %w", e.Hash.Hex(), err)
+	}
+	return tx, nil
+}
+
+// Get the hash and every journaled transaction competing with it for the
+// same nonce, so whichever gets mined is found
+func (ex *Executor) competing(hash common.Hash) []common.Hash {
+	hashes := []common.Hash{hash}
+	if ex.journal == nil {
+		return hashes
+	}
+	e := ex.journal.entry(hash)
+	if e == nil {
+		return hashes
+	}
+	for _, other := range ex.journal.entriesOf(ex.chain.ChainID, e.From) {
+		if other.Nonce == e.Nonce && other.Hash != hash && other.Status != txRejected && other.Status != txDropped {
+			hashes = append(hashes, other.Hash)
+		}
+	}
+	return hashes
+}
+
+// Get the journaled transactions of the account still waiting to be mined,
+// the newest one per nonce, lowest nonce first
+func (ex *Executor) pendingTxs(ctx context.Context) ([]*JournalEntry, error) {
+	if ex.journal == nil {
+		return nil, errors.New("the journal is disabled")
+	}
+	nonce, err := ex.Client().NonceAt(ctx, ex.account.address, nil)
+	if err != nil {
+		log.Printf("Failed to get nonce: %v", err)
+		return nil, err
+	}
+	byNonce := map[uint64]*JournalEntry{}
+	var nonces []uint64
+	for _, e := range ex.journal.entriesOf(ex.chain.ChainID, ex.account.address) {
+		if e.Nonce < nonce || (e.Status != txSending && e.Status != txSent) {
+			continue
+		}
+		if _, ok := byNonce[e.Nonce]; !ok {
+			nonces = append(nonces, e.Nonce)
+		}
+		e := e
+		byNonce[e.Nonce] = &e
+	}
+	sort.Slice(nonces, func(i, j int) bool { return nonces[i] < nonces[j] })
+	out := make([]*JournalEntry, len(nonces))
+	for i, n := range nonces {
+		out[i] = byNonce[n]
+	}
+	return out, nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var journalFrom = common.HexToAddress("0x4444444444444444444444444444444444444444")
+
+// A transaction at nonce, fee tells apart the ones sharing a nonce
+func journalTestTx(nonce uint64, fee int64) *types.Transaction {
+	to := common.HexToAddress("0x912CE59144191C1204E64559FE8253a0e49E6548")
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   testChainID,
+		Nonce:     nonce,
+		GasFeeCap: big.NewInt(fee),
+		Gas:       100000,
+		To:        &to,
+		Value:     new(big.Int),
+	})
+}
+
+func newTestJournal(t *testing.T) *Journal {
+	t.Helper()
+	j, err := OpenJournal(filepath.Join(t.TempDir(), "journal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+// Add an entry created at created with status to the journal
+func addEntry(t *testing.T, j *Journal, tx *types.Transaction, purpose, status string, created time.Time) {
+	t.Helper()
+	if err := j.add(tx, journalFrom, purpose); err != nil {
+		t.Fatal(err)
+	}
+	j.entries[len(j.entries)-1].Status = status
+	j.entries[len(j.entries)-1].Created = created
+}
+
+func TestJournalSaveAndOpen(t *testing.T) {
+	j := newTestJournal(t)
+	if len(j.entries) != 0 {
+		t.Fatalf("new journal has %d entries", len(j.entries))
+	}
+	txs := []*types.Transaction{journalTestTx(1, 100), journalTestTx(2, 100)}
+	for _, tx := range txs {
+		if err := j.add(tx, journalFrom, "claim"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := OpenJournal(j.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := reopened.entriesOf(testChainID, journalFrom)
+	if len(entries) != len(txs) {
+		t.Fatalf("reopened journal has %d entries, want %d", len(entries), len(txs))
+	}
+	for i, e := range entries {
+		tx, err := e.transaction()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Hash != txs[i].Hash() || tx.Hash() != txs[i].Hash() || e.Nonce != txs[i].Nonce() || e.Status != txSending || e.Purpose != "claim" {
+			t.Errorf("entry %d = %+v, want %s at nonce %d", i, e, txs[i].Hash().Hex(), txs[i].Nonce())
+		}
+	}
+	if others := reopened.entriesOf(big.NewInt(1), journalFrom); len(others) != 0 {
+		t.Errorf("%d entries on another chain, want none", len(others))
+	}
+
+	if err := os.WriteFile(j.path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenJournal(j.path); err == nil {
+		t.Error("corrupt journal opened without an error")
+	}
+}
+
+func TestJournalAddDedup(t *testing.T) {
+	j := newTestJournal(t)
+	tx := journalTestTx(1, 100)
+	for i := 0; i < 2; i++ {
+		if err := j.add(tx, journalFrom, "claim"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.add(journalTestTx(1, 200), journalFrom, "claim"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(j.entries); n != 2 {
+		t.Errorf("%d entries, want 2", n)
+	}
+}
+
+func TestJournalUpdate(t *testing.T) {
+	j := newTestJournal(t)
+	tx := journalTestTx(1, 100)
+	if err := j.add(tx, journalFrom, "claim"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.update(tx.Hash(), txReverted, 9, errors.New("execution reverted")); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.update(common.HexToHash("0x01"), txMined, 10, nil); err != nil {
+		t.Errorf("update of an unknown hash: %v", err)
+	}
+
+	reopened, err := OpenJournal(j.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := reopened.entry(tx.Hash())
+	if e == nil {
+		t.Fatal("entry is gone")
+	}
+	if e.Status != txReverted || e.Block != 9 || e.Error != "execution reverted" {
+		t.Errorf("entry = %s at block %d with %q, want reverted at block 9", e.Status, e.Block, e.Error)
+	}
+	if len(reopened.entries) != 1 {
+		t.Errorf("%d entries, want 1", len(reopened.entries))
+	}
+}
+
+func TestJournaled(t *testing.T) {
+	start := time.Date(2024, 3, 23, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		status   string
+		created  time.Time
+		purposes []string
+		want     bool
+	}{
+		{"sent", txSent, start, []string{"claim"}, true},
+		{"sending", txSending, start, []string{"claim"}, true},
+		{"mined", txMined, start, []string{"claim"}, true},
+		{"other purpose", txSent, start, []string{"claim", "claimAndDelegate"}, true},
+		{"rejected", txRejected, start, []string{"claim"}, false},
+		{"reverted", txReverted, start, []string{"claim"}, false},
+		{"replaced", txReplaced, start, []string{"claim"}, false},
+		{"dropped", txDropped, start, []string{"claim"}, false},
+		{"before since", txSent, start.Add(-time.Second), []string{"claim"}, false},
+		{"unwanted purpose", txSent, start, []string{"transfer"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := newTestJournal(t)
+			ex := &Executor{journal: j, chain: &Chain{ChainID: testChainID}, account: &Account{address: journalFrom}}
+			// an older claim that must lose against the one under test
+			addEntry(t, j, journalTestTx(1, 100), "claim", txSent, start)
+			tx := journalTestTx(2, 100)
+			purpose := "claim"
+			if tt.name == "other purpose" {
+				purpose = "claimAndDelegate"
+			}
+			addEntry(t, j, tx, purpose, tt.status, tt.created)
+
+			e := ex.journaled(start, tt.purposes...)
+			switch {
+			case tt.want && (e == nil || e.Hash != tx.Hash()):
+				t.Errorf("journaled = %v, want %s", e, tx.Hash().Hex())
+			case !tt.want && e != nil && e.Hash == tx.Hash():
+				t.Errorf("journaled returned the %s entry", tt.name)
+			}
+		})
+	}
+}
+
+func TestPendingTxs(t *testing.T) {
+	type entry struct {
+		nonce  uint64
+		fee    int64
+		status string
+	}
+	tests := []struct {
+		name    string
+		mined   uint64
+		entries []entry
+		want    []entry // the entries returned, in order
+	}{
+		{"empty", 5, nil, nil},
+		{
+			"newest per nonce",
+			5,
+			[]entry{{5, 100, txSent}, {5, 200, txSending}, {6, 100, txSent}},
+			[]entry{{5, 200, txSending}, {6, 100, txSent}},
+		},
+		{
+			"lowest nonce first",
+			5,
+			[]entry{{7, 100, txSent}, {6, 100, txSending}, {5, 100, txSent}},
+			[]entry{{5, 100, txSent}, {6, 100, txSending}, {7, 100, txSent}},
+		},
+		{
+			"mined nonces and settled entries skipped",
+			5,
+			[]entry{{4, 100, txSent}, {5, 100, txSent}, {5, 200, txRejected}, {6, 100, txMined}, {7, 100, txDropped}},
+			[]entry{{5, 100, txSent}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &fakeNode{}
+			chain := newFakeChain(t, node)
+			node.mined[journalFrom] = tt.mined
+			j := newTestJournal(t)
+			ex := &Executor{journal: j, chain: chain, account: &Account{address: journalFrom}}
+			for _, e := range tt.entries {
+				addEntry(t, j, journalTestTx(e.nonce, e.fee), "claim", e.status, time.Now())
+			}
+
+			got, err := ex.pendingTxs(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d pending transactions, want %d", len(got), len(tt.want))
+			}
+			for i, w := range tt.want {
+				if hash := journalTestTx(w.nonce, w.fee).Hash(); got[i].Hash != hash {
+					t.Errorf("pending %d is nonce %d %s, want nonce %d %s", i, got[i].Nonce, got[i].Hash.Hex(), w.nonce, hash.Hex())
+				}
+			}
+		})
+	}
+}
+
+// A journaled transaction whose nonce got used is settled instead of being
+// sent again, so a claim that was never mined cannot hold back later runs
+func TestRebroadcastPending(t *testing.T) {
+	stale := journalTestTx(3, 100)    // never mined, nonce used elsewhere
+	replaced := journalTestTx(4, 100) // lost against its speed up
+	speedUp := journalTestTx(4, 200)  // mined
+	own := journalTestTx(5, 100)      // mined, still marked sent
+	reverted := journalTestTx(6, 100) // mined, reverted
+	waiting := journalTestTx(7, 100)  // nonce not used yet
+	rejected := journalTestTx(8, 100) // never out, left alone
+	tests := []struct {
+		name    string
+		sendErr error
+		want    map[common.Hash]string
+	}{
+		{"sent again", nil, map[common.Hash]string{
+			stale.Hash():    txDropped,
+			replaced.Hash(): txReplaced,
+			speedUp.Hash():  txMined,
+			own.Hash():      txMined,
+			reverted.Hash(): txReverted,
+			waiting.Hash():  txSent,
+			rejected.Hash(): txRejected,
+		}},
+		{"nonce too low", errors.New("nonce too low"), map[common.Hash]string{
+			stale.Hash():   txDropped,
+			waiting.Hash(): txSending,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &fakeNode{sendErr: tt.sendErr}
+			chain := newFakeChain(t, node)
+			node.mined[journalFrom] = 7
+			node.mine(speedUp.Hash(), types.ReceiptStatusSuccessful, 20)
+			node.mine(own.Hash(), types.ReceiptStatusSuccessful, 21)
+			node.mine(reverted.Hash(), types.ReceiptStatusFailed, 22)
+			j := newTestJournal(t)
+			ex := &Executor{journal: j, chain: chain, account: &Account{address: journalFrom}}
+			now := time.Now()
+			addEntry(t, j, stale, "claim", txSent, now)
+			addEntry(t, j, replaced, "claim", txSent, now)
+			addEntry(t, j, speedUp, "claim", txSending, now)
+			addEntry(t, j, own, "transfer", txSent, now)
+			addEntry(t, j, reverted, "transfer", txSent, now)
+			addEntry(t, j, waiting, "transfer", txSending, now)
+			addEntry(t, j, rejected, "transfer", txRejected, now)
+
+			ex.rebroadcastPending(context.Background())
+			for hash, status := range tt.want {
+				if e := j.entry(hash); e.Status != status {
+					t.Errorf("nonce %d %s is %s, want %s", e.Nonce, e.Purpose, e.Status, status)
+				}
+			}
+			if e := ex.journaled(time.Time{}, "claim"); e == nil || e.Hash != speedUp.Hash() {
+				t.Errorf("journaled claim = %v, want the mined speed up", e)
+			}
+			if tt.sendErr == nil && (len(node.sent) != 1 || node.sent[0] != waiting.Hash()) {
+				t.Errorf("sent %v, want only nonce 7", node.sent)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/term"
+)
+
+// NewAccountFromKeystore decrypts a go-ethereum V3 JSON keystore file
+func NewAccountFromKeystore(path string, passphrase string) (*Account, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Failed to read keystore: %v", err)
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(data, passphrase)
+	if err != nil {
+		log.Printf("Failed to decrypt keystore %s: %v", path, err)
+		return nil, err
+	}
+	return newKeyAccount(key.PrivateKey), nil
+}
+
+// Read a passphrase from file, or prompt for it when no file is given
+func readPassphrase(file string, prompt string) (string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.Printf("Failed to read passphrase file: %v", err)
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return readSecret(prompt)
+}
+
+// Prompt for a secret on the terminal without echoing it
+func readSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		log.Printf("Failed to read from terminal: %v", err)
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// Load an account from a keystore file if one is given, or a raw hex key
+func loadAccount(prv string, keystorePath string, passwordFile string) (*Account, error) {
+	if keystorePath == "" {
+		return NewAccount(prv)
+	}
+	passphrase, err := readPassphrase(passwordFile, fmt.Sprintf("Passphrase for %s: ", keystorePath))
+	if err != nil {
+		return nil, err
+	}
+	return NewAccountFromKeystore(keystorePath, passphrase)
+}
+
+// import-key encrypts a raw private key into a new keystore file. The key is
+// read from the terminal so it never has to be written to disk in plaintext.
+func runImportKey(args []string) error {
+	fs := flag.NewFlagSet("import-key", flag.ExitOnError)
+	dir := fs.String("keystore", "keystore", "directory to write the keystore file to")
+	passwordFile := fs.String("password-file", "", "file holding the new passphrase")
+	fs.Parse(args)
+
+	prv, err := readSecret("Private key (hex): ")
+	if err != nil {
+		return err
+	}
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(prv), "0x"))
+	if err != nil {
+		log.Printf("Failed to get private key: %v", err)
+		return err
+	}
+
+	passphrase, err := readPassphrase(*passwordFile, "New passphrase: ")
+	if err != nil {
+		return err
+	}
+	if *passwordFile == "" {
+		confirm, err := readSecret("Repeat passphrase: ")
+		if err != nil {
+			return err
+		}
+		if confirm != passphrase {
+			return fmt.Errorf("passphrases do not match")
+		}
+	}
+
+	ks := keystore.NewKeyStore(*dir, keystore.StandardScryptN, keystore.StandardScryptP)
+	account, err := ks.ImportECDSA(privateKey, passphrase)
+	if err != nil {
+		log.Printf("Failed to import key: %v", err)
+		return err
+	}
+	fmt.Printf("Imported %s into %s\n", account.Address.Hex(), account.URL.Path)
+	return nil
+}
@@ -1,65 +1,28 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"os"
-	"sync"
+	"strings"
 )
 
 func main() {
-	URL := os.Getenv("HTTP_NODE")
-	PRV_KEY := os.Getenv("PRV_KEY")
-	DEST_ADDRESS := os.Getenv("DEST_ADDRESS")
-
-	mainEx, err := NewExecutor(
-		URL,
-		PRV_KEY,
-	)
-	if err != nil {
-		log.Fatalln(err)
+	// without a command the full claim-and-forward pipeline runs
+	name, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
-	claimer := &Claimer{
-		Executor: *mainEx,
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
 	}
 
-	err = claimer.buildDistributor()
-	if err != nil {
-		log.Fatalln(err)
-	}
-	err = claimer.buildToken()
-	if err != nil {
+	if err := cmd.run(args); err != nil {
+		if errors.Is(err, errSomeFailed) {
+			os.Exit(1)
+		}
 		log.Fatalln(err)
 	}
-
-	wg := &sync.WaitGroup{}
-
-	wg.Add(1)
-	go func(wg *sync.WaitGroup) {
-		for {
-			tx, err := claimer.claim()
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			log.Println(tx)
-			break
-		}
-		wg.Done()
-	}(wg)
-
-	wg.Add(1)
-	go func(wg *sync.WaitGroup) {
-		for {
-			tx, err := claimer.withdrawTokens(DEST_ADDRESS, 625.0)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			log.Println(tx)
-			break
-		}
-		wg.Done()
-	}(wg)
-
-	wg.Wait()
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Network is a named chain profile with the contracts deployed on it. A zero
+// address means the contract has to be configured explicitly.
+type Network struct {
+	Name        string
+	ChainID     *big.Int
+	Distributor common.Address
+	Token       common.Address
+}
+
+// Known networks, Arbitrum One is the default
+var networks = map[string]*Network{
+	"arbitrum-one": {
+		Name:    "arbitrum-one",
+		ChainID: big.NewInt(42161),
+		// https://arbiscan.io/address/0x67a24ce4321ab3af51c2d0a4801c3e111d88c9d9
+		Distributor: common.HexToAddress("0x67a24CE4321aB3aF51c2D0a4801c3E111D88C9d9"),
+		// https://arbiscan.io/address/0x912ce59144191c1204e64559fe8253a0e49e6548
+		Token: common.HexToAddress("0x912CE59144191C1204E64559FE8253a0e49E6548"),
+	},
+	"arbitrum-nova": {
+		Name:    "arbitrum-nova",
+		ChainID: big.NewInt(42170),
+		// https://nova.arbiscan.io/address/0xf823c3cd3cebe0a1fa952ba88dc9eef8e0bf46ad
+		Token: common.HexToAddress("0xf823C3cD3CeBE0a1fA952ba88Dc9EEf8e0Bf46AD"),
+	},
+	"arbitrum-sepolia": {
+		Name:    "arbitrum-sepolia",
+		ChainID: big.NewInt(421614),
+	},
+	"arbitrum-goerli": {
+		Name:    "arbitrum-goerli",
+		ChainID: big.NewInt(421613),
+	},
+}
+
+const defaultNetwork = "arbitrum-one"
+
+// Get a copy of a known network by name, empty means the default network
+func lookupNetwork(name string) (*Network, error) {
+	if name == "" {
+		name = defaultNetwork
+	}
+	network, ok := networks[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(networks))
+		for n := range networks {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown network %q, known: %s", name, strings.Join(names, ", "))
+	}
+	copied := *network
+	copied.ChainID = new(big.Int).Set(network.ChainID)
+	return &copied, nil
+}
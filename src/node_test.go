@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+
+	"claimer/token"
+)
+
+// Slot of the allowance mapping of the token served by fakeNode
+const fakeAllowanceSlot = 52
+
+const fakeTokenName = "Arbitrum"
+
+// fakeNode answers the eth_ methods the claimer needs for signing, with a
+// token whose allowances only exist as state overrides
+type fakeNode struct {
+	token common.Address
+
+	mu     sync.Mutex
+	nonces map[common.Address]uint64 // pending nonces
+	mined  map[common.Address]uint64 // mined nonces
+
+	tokenNonces map[common.Address]uint64 // EIP-712 nonces of the token
+
+	receipts map[common.Hash]*types.Receipt
+	sent     []common.Hash // transactions accepted by SendRawTransaction
+	sendErr  error         // returned by SendRawTransaction when set
+}
+
+type fakeCallArgs struct {
+	From  *common.Address `json:"from"`
+	To    *common.Address `json:"to"`
+	Data  hexutil.Bytes   `json:"data"`
+	Input hexutil.Bytes   `json:"input"`
+}
+
+func (a *fakeCallArgs) data() []byte {
+	if len(a.Input) > 0 {
+		return a.Input
+	}
+	return a.Data
+}
+
+type fakeOverride struct {
+	StateDiff map[common.Hash]common.Hash `json:"stateDiff"`
+}
+
+func (n *fakeNode) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(testChainID)
+}
+
+func (n *fakeNode) GetTransactionCount(account common.Address, block string) hexutil.Uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if block == "pending" {
+		return hexutil.Uint64(n.nonces[account])
+	}
+	return hexutil.Uint64(n.mined[account])
+}
+
+func (n *fakeNode) GetBlockByNumber(number string, full bool) *types.Header {
+	return &types.Header{
+		Number:     big.NewInt(100),
+		Difficulty: new(big.Int),
+		BaseFee:    big.NewInt(10000000),
+		GasLimit:   30000000,
+	}
+}
+
+func (n *fakeNode) GetTransactionReceipt(hash common.Hash) *types.Receipt {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.receipts[hash]
+}
+
+func (n *fakeNode) SendRawTransaction(raw hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return common.Hash{}, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.sendErr != nil {
+		return common.Hash{}, n.sendErr
+	}
+	n.sent = append(n.sent, tx.Hash())
+	return tx.Hash(), nil
+}
+
+// Record a receipt for hash, mined in block
+func (n *fakeNode) mine(hash common.Hash, status uint64, block int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.receipts[hash] = &types.Receipt{
+		Status:      status,
+		Logs:        []*types.Log{},
+		TxHash:      hash,
+		BlockNumber: big.NewInt(block),
+	}
+}
+
+// Read the allowance owner gave spender from the overrides of a call
+func (n *fakeNode) allowance(owner, spender common.Address, overrides *map[common.Address]fakeOverride) *big.Int {
+	if overrides == nil {
+		return new(big.Int)
+	}
+	value := (*overrides)[n.token].StateDiff[allowanceKey(owner, spender, big.NewInt(fakeAllowanceSlot))]
+	return value.Big()
+}
+
+func (n *fakeNode) Call(args fakeCallArgs, block string, overrides *map[common.Address]fakeOverride) (hexutil.Bytes, error) {
+	if args.To == nil || *args.To != n.token {
+		return nil, errors.New("no code at address")
+	}
+	parsed, _ := token.TokenMetaData.GetAbi()
+	method, err := parsed.MethodById(args.data())
+	if err != nil {
+		return nil, errors.New("execution reverted")
+	}
+	in, err := method.Inputs.Unpack(args.data()[4:])
+	if err != nil {
+		return nil, err
+	}
+	switch method.Name {
+	case "allowance":
+		value := n.allowance(in[0].(common.Address), in[1].(common.Address), overrides)
+		return common.BigToHash(value).Bytes(), nil
+	case "nonces":
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		return method.Outputs.Pack(new(big.Int).SetUint64(n.tokenNonces[in[0].(common.Address)]))
+	case "name":
+		return method.Outputs.Pack(fakeTokenName)
+	case "DOMAIN_SEPARATOR":
+		domain := n.domain()
+		data := apitypes.TypedData{Types: apitypes.Types{"EIP712Domain": eip712DomainType}, Domain: domain}
+		hash, err := data.HashStruct("EIP712Domain", domain.Map())
+		if err != nil {
+			return nil, err
+		}
+		return common.BytesToHash(hash).Bytes(), nil
+	}
+	return nil, errors.New("execution reverted")
+}
+
+// The EIP-712 domain of the token
+func (n *fakeNode) domain() apitypes.TypedDataDomain {
+	return apitypes.TypedDataDomain{
+		Name:              fakeTokenName,
+		Version:           "1",
+		ChainId:           (*math.HexOrDecimal256)(testChainID),
+		VerifyingContract: n.token.Hex(),
+	}
+}
+
+func (n *fakeNode) EstimateGas(args fakeCallArgs, block *string, overrides *map[common.Address]fakeOverride) (hexutil.Uint64, error) {
+	parsed, _ := token.TokenMetaData.GetAbi()
+	if method, err := parsed.MethodById(args.data()); err == nil && method.Name == "transferFrom" {
+		in, err := method.Inputs.Unpack(args.data()[4:])
+		if err != nil {
+			return 0, err
+		}
+		if n.allowance(in[0].(common.Address), *args.From, overrides).Cmp(in[2].(*big.Int)) < 0 {
+			return 0, errors.New("execution reverted: ERC20: insufficient allowance")
+		}
+		return 60000, nil
+	}
+	return 50000, nil
+}
+
+// Serve a fake node and connect a chain to it
+func newFakeChain(t *testing.T, node *fakeNode) *Chain {
+	t.Helper()
+	if node.nonces == nil {
+		node.nonces = map[common.Address]uint64{}
+	}
+	if node.mined == nil {
+		node.mined = map[common.Address]uint64{}
+	}
+	if node.tokenNonces == nil {
+		node.tokenNonces = map[common.Address]uint64{}
+	}
+	if node.receipts == nil {
+		node.receipts = map[common.Hash]*types.Receipt{}
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", node); err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(server)
+	t.Cleanup(hs.Close)
+	t.Cleanup(server.Stop)
+
+	client, err := rpc.Dial(hs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	network := &Network{
+		Name:        "test",
+		ChainID:     testChainID,
+		Token:       node.token,
+		Distributor: common.HexToAddress("0x67a24CE4321aB3aF51c2D0a4801c3E111D88C9d9"),
+	}
+	return &Chain{
+		pool: &RPCPool{
+			chainID:   testChainID,
+			endpoints: []*Endpoint{{URL: hs.URL, RPC: client, Client: ethclient.NewClient(client), verified: true, healthy: true}},
+		},
+		Network: network,
+		ChainID: testChainID,
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+)
+
+// NonceManager tracks the next free nonce of an account locally, so several
+// transactions can be signed ahead of time without colliding on a nonce.
+type NonceManager struct {
+	mu     sync.Mutex
+	next   uint64
+	synced bool
+}
+
+// Reserve count sequential nonces and return the first one
+func (ex *Executor) reserveNonces(count uint64) (uint64, error) {
+	nm := ex.nonces
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	if !nm.synced {
+		nonce, err := ex.getNonce()
+		if err != nil {
+			return 0, err
+		}
+		nm.next = nonce
+		nm.synced = true
+	}
+	first := nm.next
+	nm.next += count
+	return first, nil
+}
+
+// Give back a nonce that was reserved but never broadcast. Only the most
+// recent reservation can be returned, anything else is left to reconcile.
+func (ex *Executor) releaseNonce(nonce uint64) {
+	nm := ex.nonces
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	if nm.synced && nonce+1 == nm.next {
+		nm.next = nonce
+	}
+}
+
+// Resync the local nonce with the pending nonce of the chain, e.g. after a
+// failed send or when a transaction was dropped from the mempool
+func (ex *Executor) reconcileNonce() error {
+	nm := ex.nonces
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	nonce, err := ex.getNonce()
+	if err != nil {
+		return err
+	}
+	if nm.synced && nonce != nm.next {
+		log.Printf("Nonce out of sync: local %d, chain %d", nm.next, nonce)
+	}
+	nm.next = nonce
+	nm.synced = true
+	return nil
+}
+
+// isNonceError reports whether a send failed because the nonce is stale
+func isNonceError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "nonce too low") || strings.Contains(msg, "nonce too high")
+}
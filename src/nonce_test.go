@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// An executor whose getNonce answers with the pending nonce of a fake node
+func newNonceTestExecutor(t *testing.T, pending uint64) (*Executor, *fakeNode) {
+	t.Helper()
+	node := &fakeNode{}
+	chain := newFakeChain(t, node)
+	ex := NewExecutorWithChain(chain, &Account{address: journalFrom})
+	node.nonces[journalFrom] = pending
+	return ex, node
+}
+
+func reserve(t *testing.T, ex *Executor, count, want uint64) {
+	t.Helper()
+	nonce, err := ex.reserveNonces(count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != want {
+		t.Errorf("reserveNonces(%d) = %d, want %d", count, nonce, want)
+	}
+}
+
+func TestReserveNonces(t *testing.T) {
+	ex, node := newNonceTestExecutor(t, 5)
+	reserve(t, ex, 1, 5)
+	reserve(t, ex, 2, 6)
+	// the chain is only asked once, later reservations stay local
+	node.nonces[journalFrom] = 100
+	reserve(t, ex, 1, 8)
+}
+
+func TestReleaseNonce(t *testing.T) {
+	tests := []struct {
+		name     string
+		release  []uint64
+		wantNext uint64
+	}{
+		{"latest", []uint64{7}, 7},
+		{"in order", []uint64{7, 6, 5}, 5},
+		{"out of order", []uint64{5}, 8},
+		{"out of order then latest", []uint64{6, 7}, 7},
+		{"never reserved", []uint64{8}, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex, _ := newNonceTestExecutor(t, 5)
+			reserve(t, ex, 1, 5)
+			reserve(t, ex, 1, 6)
+			reserve(t, ex, 1, 7)
+			for _, nonce := range tt.release {
+				ex.releaseNonce(nonce)
+			}
+			reserve(t, ex, 1, tt.wantNext)
+		})
+	}
+}
+
+func TestReleaseNonceBeforeSync(t *testing.T) {
+	ex, _ := newNonceTestExecutor(t, 5)
+	ex.releaseNonce(4)
+	reserve(t, ex, 1, 5)
+}
+
+func TestReconcileNonce(t *testing.T) {
+	tests := []struct {
+		name    string
+		pending uint64 // pending nonce of the chain at the reconcile
+	}{
+		{"behind", 3},
+		{"in sync", 7},
+		{"ahead", 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex, node := newNonceTestExecutor(t, 5)
+			reserve(t, ex, 2, 5)
+			node.nonces[journalFrom] = tt.pending
+			if err := ex.reconcileNonce(); err != nil {
+				t.Fatal(err)
+			}
+			reserve(t, ex, 1, tt.pending)
+		})
+	}
+}
+
+func TestReconcileNonceBeforeSync(t *testing.T) {
+	ex, _ := newNonceTestExecutor(t, 9)
+	if err := ex.reconcileNonce(); err != nil {
+		t.Fatal(err)
+	}
+	reserve(t, ex, 1, 9)
+}
+
+func TestIsNonceError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("nonce too low"), true},
+		{errors.New("nonce too high: address 0x1, tx: 9 state: 5"), true},
+		{errors.New("replacement transaction underpriced"), false},
+		{errors.New("insufficient funds for gas * price + value"), false},
+	}
+	for _, tt := range tests {
+		if got := isNonceError(tt.err); got != tt.want {
+			t.Errorf("isNonceError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// PipelineResult is the outcome of claiming and forwarding for one wallet
+type PipelineResult struct {
+	Address     common.Address
+	Destination string
+	Claimed     *big.Int
+	Forwarded   *big.Int
+	Decimals    uint8
+	FundTx      string // set when a rescue funded the wallet
+	ClaimTx     string
+	PermitTx    string // set when the relayer forwarded the tokens
+	WithdrawTx  string
+	Err         error
+}
+
+// PipelineOptions are shared by every wallet of a run
+type PipelineOptions struct {
+	Amount         *WithdrawAmount
+	Delegate       common.Address // claim and delegate to this address when set
+	Gasless        bool           // forward through Relayer with a permit
+	Relayer        *Claimer
+	LeadBlocks     uint64
+	PollInterval   time.Duration
+	Backoff        Backoff
+	ReceiptTimeout time.Duration
+}
+
+// Build a Claimer with the distributor and token contracts bound
+func newClaimer(ex *Executor) (*Claimer, error) {
+	claimer := &Claimer{
+		Executor: *ex,
+	}
+	if err := claimer.buildDistributor(); err != nil {
+		return nil, err
+	}
+	if err := claimer.buildToken(); err != nil {
+		return nil, err
+	}
+	return claimer, nil
+}
+
+// Run the claim-and-forward pipeline for one account: check the allocation,
+// pre-sign claim and transfer, wait for the window and send both. A claim
+// left in the journal by an interrupted run is picked up instead.
+func runPipeline(ctx context.Context, claimer *Claimer, dest string, opts *PipelineOptions) *PipelineResult {
+	result := &PipelineResult{
+		Address:     claimer.account.address,
+		Destination: dest,
+	}
+
+	claimer.rebroadcastPending(ctx)
+	if entry := claimer.journaled(time.Time{}, "claim", "claimAndDelegate"); entry != nil {
+		return resumePipeline(ctx, claimer, dest, opts, entry, result)
+	}
+
+	// don't spend gas on a claim that is bound to revert
+	claimable, err := claimer.checkEligibility()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Decimals, err = claimer.tokenDecimals()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	amount, err := claimer.withdrawAmount(opts.Amount, claimable)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	// claim at nonce N and forward the tokens at N+1, both signed up front
+	claimTx, withdrawTx, err := presign(claimer, dest, amount, opts.Delegate)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	scheduler := pipelineScheduler(claimer, opts)
+	if err := scheduler.waitForWindow(ctx); err != nil {
+		result.Err = err
+		return result
+	}
+
+	var outcome *TxOutcome
+	for {
+		result.ClaimTx, err = scheduler.fire(ctx, true, func() (string, error) {
+			if claimTx == nil {
+				var err error
+				claimTx, withdrawTx, err = resign(claimer, dest, amount, opts.Delegate)
+				if err != nil {
+					return "", err
+				}
+			}
+			hash, err := claimer.sendTx(claimTx)
+			if isNonceError(err) {
+				// sign both again on the next attempt
+				claimTx, withdrawTx = nil, nil
+			}
+			return hash, err
+		})
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		log.Printf("Claim sent for %s: %s", result.Address.Hex(), result.ClaimTx)
+
+		outcome, err = claimer.confirm(ctx, result.ClaimTx, opts.ReceiptTimeout)
+		if errors.Is(err, errClaimNotStarted) && claimer.dryRun == nil {
+			// fired ahead of the window, the nonce is spent so sign both
+			// again, and fire only once the window is really open
+			claimTx, withdrawTx = nil, nil
+			if err := scheduler.waitForStart(ctx); err != nil {
+				result.Err = err
+				return result
+			}
+			continue
+		}
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		break
+	}
+	result.Claimed = outcome.Claimed
+
+	forward(ctx, scheduler, claimer, dest, amount, withdrawTx, opts, result)
+	return result
+}
+
+// Finish a run that stopped after sending the claim: wait for the journaled
+// claim, then for the journaled transfer or, when there is none, forward
+// what the wallet holds now
+func resumePipeline(ctx context.Context, claimer *Claimer, dest string, opts *PipelineOptions, claim *JournalEntry, result *PipelineResult) *PipelineResult {
+	log.Printf("Resuming %s from %s %s", result.Address.Hex(), claim.Purpose, claim.Hash.Hex())
+	var err error
+	result.Decimals, err = claimer.tokenDecimals()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.ClaimTx = claim.Hash.Hex()
+	outcome, err := claimer.confirm(ctx, result.ClaimTx, opts.ReceiptTimeout)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Claimed = outcome.Claimed
+
+	if transfer := claimer.journaled(claim.Created, "transfer"); transfer != nil && !opts.Gasless {
+		result.WithdrawTx = transfer.Hash.Hex()
+		outcome, err = claimer.confirm(ctx, result.WithdrawTx, opts.ReceiptTimeout)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		result.Forwarded = forwarded(outcome, result.Address, dest)
+		return result
+	}
+
+	amount, err := claimer.withdrawAmount(opts.Amount, new(big.Int))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	forward(ctx, pipelineScheduler(claimer, opts), claimer, dest, amount, nil, opts, result)
+	return result
+}
+
+// Forward amount to dest once the claim is mined, through the relayer when
+// gasless. withdrawTx is the pre-signed transfer, nil to sign a new one.
+func forward(ctx context.Context, scheduler *Scheduler, claimer *Claimer, dest string, amount *big.Int, withdrawTx *types.Transaction, opts *PipelineOptions, result *PipelineResult) {
+	var outcome *TxOutcome
+	var err error
+	if opts.Gasless {
+		result.PermitTx, result.WithdrawTx, outcome, err = relayForward(ctx, scheduler, claimer, opts.Relayer, dest, amount, opts.ReceiptTimeout)
+		if err != nil {
+			result.Err = err
+			return
+		}
+		result.Forwarded = forwarded(outcome, result.Address, dest)
+		return
+	}
+
+	result.WithdrawTx, err = scheduler.fire(ctx, false, func() (string, error) {
+		if withdrawTx == nil {
+			var err error
+			withdrawTx, err = resignWithdraw(claimer, dest, amount)
+			if err != nil {
+				return "", err
+			}
+		}
+		hash, err := claimer.sendTx(withdrawTx)
+		if isNonceError(err) {
+			withdrawTx = nil
+		}
+		return hash, err
+	})
+	if err != nil {
+		result.Err = err
+		return
+	}
+	log.Printf("Transfer sent for %s: %s", result.Address.Hex(), result.WithdrawTx)
+
+	outcome, err = claimer.confirm(ctx, result.WithdrawTx, opts.ReceiptTimeout)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	result.Forwarded = forwarded(outcome, result.Address, dest)
+}
+
+// Build a scheduler with the timing of the options
+func pipelineScheduler(claimer *Claimer, opts *PipelineOptions) *Scheduler {
+	scheduler := NewScheduler(claimer)
+	scheduler.LeadBlocks = opts.LeadBlocks
+	scheduler.PollInterval = opts.PollInterval
+	scheduler.Backoff = opts.Backoff
+	return scheduler
+}
+
+// Sum the tokens moved from owner to dest by a transaction
+func forwarded(outcome *TxOutcome, owner common.Address, dest string) *big.Int {
+	total := new(big.Int)
+	for _, ev := range outcome.Transfers {
+		if ev.From == owner && ev.To == common.HexToAddress(dest) {
+			total.Add(total, ev.Value)
+		}
+	}
+	return total
+}
+
+// errResignFailed stops retrying a send that has to be signed again first
+var errResignFailed = errors.New("failed to sign again")
+
+// The relayer is shared by every wallet of a batch. Only one wallet uses it
+// at a time, so its nonces can be resynced and given back safely.
+var relayLock sync.Mutex
+
+// Forward tokens through the relayer: the wallet signs a permit for the
+// relayer, which submits it and pulls the tokens to dest, so the wallet
+// needs no ETH beyond the claim
+func relayForward(ctx context.Context, scheduler *Scheduler, claimer *Claimer, relayer *Claimer, dest string, amount *big.Int, timeout time.Duration) (string, string, *TxOutcome, error) {
+	owner := claimer.account.address
+	deadline := big.NewInt(time.Now().Add(permitValidity).Unix())
+	sig, err := claimer.signPermit(relayer.account.address, amount, deadline)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	relayLock.Lock()
+	defer relayLock.Unlock()
+	permitTx, transferTx, err := presignRelay(relayer, owner, dest, amount, deadline, sig)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	permitHash, err := scheduler.fire(ctx, false, func() (string, error) {
+		if permitTx == nil {
+			// every other wallet waits for the relayer, so give up at once
+			var err error
+			if err = relayer.reconcileNonce(); err == nil {
+				permitTx, transferTx, err = presignRelay(relayer, owner, dest, amount, deadline, sig)
+			}
+			if err != nil {
+				return "", fmt.Errorf("%w: %w", errResignFailed, err)
+			}
+		}
+		hash, err := relayer.sendTx(permitTx)
+		if isNonceError(err) {
+			// sign both again on the next attempt
+			permitTx, transferTx = nil, nil
+		}
+		return hash, err
+	})
+	if err != nil {
+		if permitTx != nil {
+			// neither went out, give both nonces back
+			relayer.releaseNonce(transferTx.Nonce())
+			relayer.releaseNonce(permitTx.Nonce())
+		}
+		return "", "", nil, err
+	}
+	log.Printf("Permit for %s sent by relayer: %s", owner.Hex(), permitHash)
+
+	transferHash, err := scheduler.fire(ctx, false, func() (string, error) {
+		return relayer.sendTx(transferTx)
+	})
+	if err != nil {
+		relayer.releaseNonce(transferTx.Nonce())
+		return permitHash, "", nil, err
+	}
+	log.Printf("Transfer for %s sent by relayer: %s", owner.Hex(), transferHash)
+
+	if _, err := relayer.confirm(ctx, permitHash, timeout); err != nil {
+		return permitHash, transferHash, nil, err
+	}
+	outcome, err := relayer.confirm(ctx, transferHash, timeout)
+	return permitHash, transferHash, outcome, err
+}
+
+// Reserve two relayer nonces and sign the permit and the pull of the tokens
+func presignRelay(relayer *Claimer, owner common.Address, dest string, amount *big.Int, deadline *big.Int, sig *Signature) (*types.Transaction, *types.Transaction, error) {
+	permitCall, err := relayer.permitCall(owner, amount, deadline, sig)
+	if err != nil {
+		return nil, nil, err
+	}
+	transferCall, err := relayer.transferFromCall(owner, dest, amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	txs, err := relayer.signCalls(permitCall, transferCall)
+	if err != nil {
+		return nil, nil, err
+	}
+	return txs[0], txs[1], nil
+}
+
+// Reserve two sequential nonces and sign the claim and the transfer. With a
+// delegatee the claim also delegates the voting power.
+func presign(claimer *Claimer, dest string, amount *big.Int, delegatee common.Address) (*types.Transaction, *types.Transaction, error) {
+	claimCall, err := claimer.claimCall(delegatee)
+	if err != nil {
+		return nil, nil, err
+	}
+	withdrawCall, err := claimer.withdrawCall(dest, amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	txs, err := claimer.signCalls(claimCall, withdrawCall)
+	if err != nil {
+		return nil, nil, err
+	}
+	return txs[0], txs[1], nil
+}
+
+// Resync with the chain after a nonce error and sign both transactions
+// again. Failures are returned, retrying is up to the scheduler.
+func resign(claimer *Claimer, dest string, amount *big.Int, delegatee common.Address) (*types.Transaction, *types.Transaction, error) {
+	if err := claimer.reconcileNonce(); err != nil {
+		return nil, nil, err
+	}
+	return presign(claimer, dest, amount, delegatee)
+}
+
+// Resync with the chain and sign the transfer again once the claim is out
+func resignWithdraw(claimer *Claimer, dest string, amount *big.Int) (*types.Transaction, error) {
+	if err := claimer.reconcileNonce(); err != nil {
+		return nil, err
+	}
+	call, err := claimer.withdrawCall(dest, amount)
+	if err != nil {
+		return nil, err
+	}
+	txs, err := claimer.signCalls(call)
+	if err != nil {
+		return nil, err
+	}
+	return txs[0], nil
+}
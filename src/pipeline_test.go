@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"claimer/dist"
+)
+
+// newTestClaimer builds a claimer for a fresh key on chain
+func newTestClaimer(t *testing.T, chain *Chain) *Claimer {
+	t.Helper()
+	signer := newTestKeySigner(t)
+	cl := &Claimer{Executor: *NewExecutorWithChain(chain, &Account{signer: signer, address: signer.Address()})}
+	if err := cl.buildDistributor(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.buildToken(); err != nil {
+		t.Fatal(err)
+	}
+	return cl
+}
+
+// The relayer signs transferFrom before the permit granting it the
+// allowance is mined, so its estimate has to assume the permit
+func TestPresignRelayZeroAllowance(t *testing.T) {
+	node := &fakeNode{token: common.HexToAddress("0x912CE59144191C1204E64559FE8253a0e49E6548")}
+	chain := newFakeChain(t, node)
+	relayer := newTestClaimer(t, chain)
+	node.nonces[relayer.account.address] = 5
+
+	owner := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	dest := "0x3333333333333333333333333333333333333333"
+	amount := big.NewInt(1000)
+	permitTx, transferTx, err := presignRelay(relayer, owner, dest, amount, big.NewInt(1700000000), &Signature{V: 27})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if permitTx.Nonce() != 5 || transferTx.Nonce() != 6 {
+		t.Errorf("nonces %d and %d, want 5 and 6", permitTx.Nonce(), transferTx.Nonce())
+	}
+	policy := DefaultFeePolicy()
+	if want := uint64(60000 * policy.GasMultiplier); transferTx.Gas() != want {
+		t.Errorf("transferFrom gas limit %d, want %d from the estimate", transferTx.Gas(), want)
+	}
+}
+
+// The distributor checks the delegation at token nonce 0, whatever nonce
+// the account is at
+func TestClaimCallDelegationNonce(t *testing.T) {
+	delegatee := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	tests := []struct {
+		name    string
+		nonce   uint64
+		wantErr error
+	}{
+		{"unused nonce", 0, nil},
+		{"used nonce", 3, errDelegationNonceUsed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &fakeNode{token: common.HexToAddress("0x912CE59144191C1204E64559FE8253a0e49E6548")}
+			chain := newFakeChain(t, node)
+			cl := newTestClaimer(t, chain)
+			node.tokenNonces[cl.account.address] = tt.nonce
+
+			call, err := cl.claimCall(delegatee)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, _ := dist.DistMetaData.GetAbi()
+			in, err := parsed.Methods["claimAndDelegate"].Inputs.Unpack(call.Data[4:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig := &Signature{V: in[2].(uint8), R: in[3].([32]byte), S: in[4].([32]byte)}
+			data := delegationData(node.domain(), delegatee, new(big.Int), in[1].(*big.Int))
+			if signer, err := recoverTypedData(data, sig); err != nil || signer != cl.account.address {
+				t.Errorf("delegation at nonce 0 recovers to %s, %v, want %s", signer.Hex(), err, cl.account.address.Hex())
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"claimer/token"
+)
+
+var (
+	errTxReverted  = errors.New("transaction reverted")
+	errTxTimeout   = errors.New("timed out waiting for transaction")
+	errTxCancelled = errors.New("transaction cancelled")
+)
+
+// TxOutcome is the definitive result of a mined transaction
+type TxOutcome struct {
+	Hash      common.Hash
+	Block     uint64
+	GasUsed   uint64
+	Success   bool
+	Claimed   *big.Int               // amount of the HasClaimed event, if any
+	Transfers []*token.TokenTransfer // token Transfer events
+}
+
+// Check for the receipt of a transaction on every new block, or whenever
+// nudge fires, until it is mined or timeout passes. Journaled transactions
+// at the same nonce count too, and with a replacement policy the newest of
+// them is sped up whenever it stays unmined for too long.
+func (ex *Executor) waitMined(ctx context.Context, hash common.Hash, timeout time.Duration, nudge <-chan struct{}) (*types.Receipt, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	policy := ex.feePolicy()
+	newest, replacements, lastSent := hash, 0, time.Now()
+
+	blocks, stop := ex.newBlocks(ctx, time.Second)
+	defer stop()
+	for {
+		for _, h := range ex.competing(hash) {
+			receipt, err := ex.Client().TransactionReceipt(ctx, h)
+			if err == nil {
+				return receipt, nil
+			}
+			if !errors.Is(err, ethereum.NotFound) && ctx.Err() == nil {
+				log.Printf("Failed to get receipt of %s: %v", h.Hex(), err)
+			}
+		}
+
+		if ex.journal != nil && policy.ReplaceAfter > 0 && replacements < policy.MaxReplacements && time.Since(lastSent) >= policy.ReplaceAfter {
+			if h, err := ex.speedUp(newest); err == nil {
+				newest = h
+			} else {
+				log.Printf("Failed to speed up %s: %v", newest.Hex(), err)
+			}
+			replacements++
+			lastSent = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w %s", errTxTimeout, hash.Hex())
+		case <-blocks:
+		case <-nudge:
+		}
+	}
+}
+
+// Wait for a transaction to be mined and check its status
+func (ex *Executor) confirmTx(ctx context.Context, hash string, timeout time.Duration, nudge <-chan struct{}) (*TxOutcome, *types.Receipt, error) {
+	receipt, err := ex.waitMined(ctx, common.HexToHash(hash), timeout, nudge)
+	if err != nil {
+		return nil, nil, err
+	}
+	if receipt.TxHash != common.HexToHash(hash) {
+		log.Printf("Transaction %s was replaced by %s", hash, receipt.TxHash.Hex())
+		if ex.cancelled(common.HexToHash(hash), receipt.TxHash) {
+			ex.journalStatus(receipt.TxHash, txMined, receipt.BlockNumber.Uint64(), nil)
+			return nil, nil, fmt.Errorf("%w %s by %s", errTxCancelled, hash, receipt.TxHash.Hex())
+		}
+	}
+	outcome := &TxOutcome{
+		Hash:    receipt.TxHash,
+		Block:   receipt.BlockNumber.Uint64(),
+		GasUsed: receipt.GasUsed,
+		Success: receipt.Status == types.ReceiptStatusSuccessful,
+	}
+	if !outcome.Success {
+		reason := ex.revertReasonOf(ctx, receipt.TxHash, receipt.BlockNumber)
+		log.Printf("Transaction %s reverted in block %d: %v", hash, outcome.Block, reason)
+		ex.journalStatus(receipt.TxHash, txReverted, outcome.Block, reason)
+		return outcome, receipt, fmt.Errorf("%w %s: %w", errTxReverted, hash, reason)
+	}
+	ex.journalStatus(receipt.TxHash, txMined, outcome.Block, nil)
+	log.Printf("Transaction %s confirmed in block %d, gas used %d", hash, outcome.Block, outcome.GasUsed)
+	return outcome, receipt, nil
+}
+
+// Wait for a claim or token transaction and decode the events it emitted
+func (cl *Claimer) confirm(ctx context.Context, hash string, timeout time.Duration) (*TxOutcome, error) {
+	if cl.dryRun != nil {
+		return cl.simulatedOutcome(hash)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// with a websocket the claim or transfer event wakes us up right away
+	outcome, receipt, err := cl.confirmTx(ctx, hash, timeout, cl.watchEvents(ctx))
+	if err != nil {
+		return outcome, err
+	}
+	for _, l := range receipt.Logs {
+		switch l.Address {
+		case cl.distAddress:
+			if ev, err := cl.distContract.ParseHasClaimed(*l); err == nil {
+				outcome.Claimed = ev.Amount
+			}
+		case cl.tokenAddress:
+			if ev, err := cl.tokenContract.ParseTransfer(*l); err == nil {
+				outcome.Transfers = append(outcome.Transfers, ev)
+			}
+		}
+	}
+	return outcome, nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Smallest fee increase, in percent, that nodes accept from a transaction
+// replacing a pending one at the same nonce (the geth txpool default)
+const minBumpPercent = 10
+
+// Raise a fee by percent, rounding up. Nodes also want a strictly higher
+// tip, so a zero tip becomes one wei.
+func bumpFee(fee *big.Int, percent int64) *big.Int {
+	bumped := new(big.Int).Mul(fee, big.NewInt(100+percent))
+	bumped.Add(bumped, big.NewInt(99))
+	bumped.Div(bumped, big.NewInt(100))
+	if bumped.Cmp(fee) <= 0 {
+		bumped.Add(fee, big.NewInt(1))
+	}
+	return bumped
+}
+
+// Get the fees for a transaction replacing old: those of the fee policy,
+// but at least the bump over old that nodes ask for
+func (ex *Executor) replacementFees(old *types.Transaction) (*Fees, error) {
+	fees, err := ex.getFees()
+	if err != nil {
+		return nil, err
+	}
+	policy := ex.feePolicy()
+	percent := policy.BumpPercent
+	if percent < minBumpPercent {
+		percent = minBumpPercent
+	}
+	if tip := bumpFee(old.GasTipCap(), percent); tip.Cmp(fees.TipCap) > 0 {
+		fees.TipCap = tip
+	}
+	if feeCap := bumpFee(old.GasFeeCap(), percent); feeCap.Cmp(fees.FeeCap) > 0 {
+		fees.FeeCap = feeCap
+	}
+	if fees.TipCap.Cmp(fees.FeeCap) > 0 {
+		fees.FeeCap = new(big.Int).Set(fees.TipCap)
+	}
+	if policy.MaxFeeCap != nil && fees.FeeCap.Cmp(policy.MaxFeeCap) > 0 {
+		err := fmt.Errorf("replacing %s needs a max fee of %v, above the cap of %v", old.Hash().Hex(), fees.FeeCap, policy.MaxFeeCap)
+		log.Printf("Failed to get fees: %v", err)
+		return nil, err
+	}
+	return fees, nil
+}
+
+// Sign a copy of old with higher fees, or with cancel a zero value transfer
+// to the account itself, at the same nonce
+func (ex *Executor) signReplacement(old *types.Transaction, cancel bool) (*types.Transaction, error) {
+	fees, err := ex.replacementFees(old)
+	if err != nil {
+		return nil, err
+	}
+	inner := &types.DynamicFeeTx{
+		ChainID:    ex.chain.ChainID,
+		Nonce:      old.Nonce(),
+		GasTipCap:  fees.TipCap,
+		GasFeeCap:  fees.FeeCap,
+		Gas:        old.Gas(),
+		To:         old.To(),
+		Value:      old.Value(),
+		Data:       old.Data(),
+		AccessList: old.AccessList(),
+	}
+	if cancel {
+		self := ex.account.address
+		inner.To = &self
+		inner.Value = new(big.Int)
+		inner.Data = nil
+		inner.AccessList = nil
+	}
+
+	return ex.signTx(inner)
+}
+
+// Send a replacement for a pending transaction of the account, speeding it
+// up or cancelling it, and mark the old one replaced in the journal
+func (ex *Executor) replaceTx(old *types.Transaction, cancel bool) (*types.Transaction, error) {
+	tx, err := ex.signReplacement(old, cancel)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ex.sendTx(tx); err != nil {
+		return nil, err
+	}
+	ex.journalStatus(old.Hash(), txReplaced, 0, nil)
+	action := "Sped up"
+	if cancel {
+		action = "Cancelled"
+	}
+	log.Printf("%s %s at nonce %d with %s, max fee %v", action, old.Hash().Hex(), old.Nonce(), tx.Hash().Hex(), tx.GasFeeCap())
+	return tx, nil
+}
+
+// Speed up a journaled transaction that is taking too long, for the
+// automatic replacement policy. Returns the hash of the replacement.
+func (ex *Executor) speedUp(hash common.Hash) (common.Hash, error) {
+	if ex.journal == nil {
+		return common.Hash{}, errors.New("the journal is disabled")
+	}
+	e := ex.journal.entry(hash)
+	if e == nil {
+		return common.Hash{}, fmt.Errorf("%s is not in the journal", hash.Hex())
+	}
+	old, err := e.transaction()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	tx, err := ex.replaceTx(old, false)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), nil
+}
+
+// Tell whether the transaction mined in place of hash is a cancellation: a
+// zero value transfer of the account to itself
+func (ex *Executor) cancelled(hash common.Hash, mined common.Hash) bool {
+	if ex.journal == nil {
+		return false
+	}
+	a, b := ex.journal.entry(hash), ex.journal.entry(mined)
+	if a == nil || b == nil || a.Purpose == b.Purpose {
+		return false
+	}
+	tx, err := b.transaction()
+	if err != nil {
+		return false
+	}
+	return tx.To() != nil && *tx.To() == b.From && tx.Value().Sign() == 0 && len(tx.Data()) == 0
+}
+
+// speed-up and cancel replace the journaled transactions of every wallet
+// that are still waiting to be mined
+func cmdSpeedUp(args []string) error {
+	return replacePending("speed-up", args, false)
+}
+
+func cmdCancel(args []string) error {
+	return replacePending("cancel", args, true)
+}
+
+func replacePending(name string, args []string, cancel bool) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	nonce := fs.Int64("nonce", -1, "only replace the transaction at this nonce")
+	wait := fs.Bool("wait", false, "wait for the replacements to be mined")
+	c, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	if c.settings.DryRun != nil {
+		return fmt.Errorf("%s does not support -dry-run", name)
+	}
+	claimers, _, err := c.claimers()
+	if err != nil {
+		return err
+	}
+
+	type replaceReport struct {
+		Address  string `json:"address"`
+		Nonce    uint64 `json:"nonce,omitempty"`
+		Purpose  string `json:"purpose,omitempty"`
+		Replaced string `json:"replaced,omitempty"`
+		Tx       string `json:"tx,omitempty"`
+		Block    uint64 `json:"block,omitempty"`
+		Error    string `json:"error,omitempty"`
+	}
+	reports := make([][]replaceReport, len(claimers))
+	forEach(len(claimers), c.settings.Parallel, func(i int) {
+		cl := claimers[i]
+		address := cl.account.address.Hex()
+		pending, err := cl.pendingTxs(c.ctx)
+		if err != nil {
+			reports[i] = []replaceReport{{Address: address, Error: err.Error()}}
+			return
+		}
+		for _, e := range pending {
+			if *nonce >= 0 && e.Nonce != uint64(*nonce) {
+				continue
+			}
+			r := replaceReport{Address: address, Nonce: e.Nonce, Purpose: e.Purpose, Replaced: e.Hash.Hex()}
+			old, err := e.transaction()
+			if err == nil {
+				var tx *types.Transaction
+				tx, err = cl.replaceTx(old, cancel)
+				if err == nil {
+					r.Tx = tx.Hash().Hex()
+				}
+			}
+			if err == nil && *wait {
+				var outcome *TxOutcome
+				outcome, _, err = cl.confirmTx(c.ctx, r.Tx, c.settings.Pipeline.ReceiptTimeout, nil)
+				if outcome != nil {
+					r.Block = outcome.Block
+				}
+			}
+			r.Error = errString(err)
+			reports[i] = append(reports[i], r)
+		}
+	})
+
+	var report []replaceReport
+	failed := false
+	for _, rs := range reports {
+		for _, r := range rs {
+			report = append(report, r)
+			failed = failed || r.Error != ""
+		}
+	}
+	c.print(report, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "WALLET\tNONCE\tPURPOSE\tREPLACED\tTX\tBLOCK\tERROR")
+		for _, r := range report {
+			block := "-"
+			if r.Block != 0 {
+				block = fmt.Sprint(r.Block)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", r.Address, r.Nonce, orDash(r.Purpose), orDash(r.Replaced), orDash(r.Tx), block, orDash(r.Error))
+		}
+	})
+	if len(report) == 0 {
+		fmt.Fprintln(os.Stderr, "Nothing pending in the journal")
+	}
+	if failed {
+		return errSomeFailed
+	}
+	return nil
+}
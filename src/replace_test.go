@@ -0,0 +1,27 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestBumpFee(t *testing.T) {
+	tests := []struct {
+		fee     int64
+		percent int64
+		want    int64
+	}{
+		{0, 10, 1},
+		{1, 10, 2},
+		{9, 10, 10},
+		{100, 10, 110},
+		{100, 12, 112},
+		{1000000001, 10, 1100000002},
+		{100000000, 0, 100000001},
+	}
+	for _, tt := range tests {
+		if got := bumpFee(big.NewInt(tt.fee), tt.percent); got.Cmp(big.NewInt(tt.want)) != 0 {
+			t.Errorf("bumpFee(%d, %d) = %v, want %d", tt.fee, tt.percent, got, tt.want)
+		}
+	}
+}
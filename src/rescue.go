@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Rescue a wallet whose key leaked: every ETH sent to it gets swept, so the
+// claim and the transfer are signed up front, and the funding once the
+// window opens, and all three are broadcast together. The funding covers
+// exactly the worst case cost of claim and transfer.
+func runRescue(ctx context.Context, funder *Executor, claimer *Claimer, dest string, opts *PipelineOptions) *PipelineResult {
+	result := &PipelineResult{
+		Address:     claimer.account.address,
+		Destination: dest,
+	}
+
+	claimable, err := claimer.checkEligibility()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Decimals, err = claimer.tokenDecimals()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	amount, err := claimer.withdrawAmount(opts.Amount, claimable)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	// claim at N and transfer at N+1, from the compromised wallet
+	claimTx, withdrawTx, err := presign(claimer, dest, amount, opts.Delegate)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	txs := []*types.Transaction{claimTx, withdrawTx}
+
+	scheduler := pipelineScheduler(claimer, opts)
+	if err := scheduler.waitForWindow(ctx); err != nil {
+		result.Err = err
+		return result
+	}
+
+	// every wallet is funded by the same account, so one wallet at a time
+	// signs and broadcasts its funding and no funder nonce is left unsent
+	funderLock.Lock()
+	fundTx, err := fundRescue(funder, claimer, claimTx, withdrawTx)
+	if err != nil {
+		funderLock.Unlock()
+		result.Err = err
+		return result
+	}
+	if fundTx != nil {
+		txs = append([]*types.Transaction{fundTx}, txs...)
+		result.FundTx = fundTx.Hash().Hex()
+	}
+
+	errs := make([]error, len(txs))
+	if claimer.dryRun != nil {
+		if fundTx != nil {
+			_, errs[0] = funder.sendTx(txs[0])
+		}
+		for i := len(txs) - 2; i < len(txs); i++ {
+			_, errs[i] = claimer.sendTx(txs[i])
+		}
+	} else {
+		// the funding belongs to the funder, the rest to the rescued wallet
+		owner := func(i int) *Executor {
+			if fundTx != nil && i == 0 {
+				return funder
+			}
+			return &claimer.Executor
+		}
+		for i, tx := range txs {
+			owner(i).journalTx(tx)
+		}
+		errs = claimer.chain.SendTransactions(ctx, txs)
+		for i, tx := range txs {
+			if errs[i] == nil {
+				owner(i).journalStatus(tx.Hash(), txSent, 0, nil)
+			}
+		}
+		if fundTx != nil && errs[0] != nil {
+			funder.journalStatus(fundTx.Hash(), txRejected, 0, errs[0])
+		}
+	}
+	if fundTx != nil && errs[0] != nil {
+		funder.releaseNonce(fundTx.Nonce())
+	}
+	funderLock.Unlock()
+
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("Rescue transaction %s of %s not accepted yet: %v", txs[i].Hash().Hex(), result.Address.Hex(), err)
+		}
+	}
+	if fundTx != nil && errs[0] != nil {
+		result.Err = fmt.Errorf("funding transaction rejected: %w", errs[0])
+		return result
+	}
+
+	// nodes may turn down the claim until the funding is mined, so keep
+	// pushing the same signed transactions; signing new ones would need
+	// different funding
+	resend := func(tx *types.Transaction, err error, untilClose bool) (string, error) {
+		if err == nil {
+			return tx.Hash().Hex(), nil
+		}
+		return scheduler.fire(ctx, untilClose, func() (string, error) {
+			hash, err := claimer.sendTx(tx)
+			if isNonceError(err) {
+				return "", fmt.Errorf("nonce %d of %s already used, the sweeper was faster: %w", tx.Nonce(), result.Address.Hex(), err)
+			}
+			return hash, err
+		})
+	}
+	n := len(txs)
+	result.ClaimTx, err = resend(claimTx, errs[n-2], true)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.WithdrawTx, err = resend(withdrawTx, errs[n-1], false)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	outcome, err := claimer.confirm(ctx, result.ClaimTx, opts.ReceiptTimeout)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Claimed = outcome.Claimed
+	outcome, err = claimer.confirm(ctx, result.WithdrawTx, opts.ReceiptTimeout)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Forwarded = forwarded(outcome, result.Address, dest)
+	return result
+}
+
+// The funder is shared by every wallet of a rescue
+var funderLock sync.Mutex
+
+// Sign the funding covering the worst case cost of claim and transfer,
+// less whatever the sweeper left behind. Returns nil when none is needed.
+func fundRescue(funder *Executor, claimer *Claimer, claimTx *types.Transaction, withdrawTx *types.Transaction) (*types.Transaction, error) {
+	need := new(big.Int).Add(claimTx.Cost(), withdrawTx.Cost())
+	balance, err := claimer.ethBalance()
+	if err != nil {
+		return nil, err
+	}
+	need.Sub(need, balance)
+	if need.Sign() <= 0 {
+		return nil, nil
+	}
+	fundTxs, err := funder.signCalls(transferCall(claimer.account.address, need))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Funding %s with %s ETH from %s", claimer.account.address.Hex(), formatUnits(need, 18), funder.account.address.Hex())
+	return fundTxs[0], nil
+}
+
+// rescue claims and forwards for wallets with a leaked key, funded just in
+// time from the funder wallet of the profile
+func cmdRescue(args []string) error {
+	fs := flag.NewFlagSet("rescue", flag.ExitOnError)
+	c, err := setup(fs, args)
+	if err != nil {
+		return err
+	}
+	if c.settings.Funder == nil {
+		return errors.New("no funder configured")
+	}
+	account, err := openAccount(*c.settings.Funder)
+	if err != nil {
+		return err
+	}
+	funder := c.settings.executor(c.chain, account)
+	claimers, wallets, err := c.claimers()
+	if err != nil {
+		return err
+	}
+
+	results := make([]*PipelineResult, len(claimers))
+	forEach(len(claimers), c.settings.Parallel, func(i int) {
+		results[i] = runRescue(c.ctx, funder, claimers[i], wallets[i].Destination, c.settings.Pipeline)
+	})
+
+	type rescueReport struct {
+		Address     string `json:"address"`
+		Destination string `json:"destination"`
+		Claimed     string `json:"claimed,omitempty"`
+		Forwarded   string `json:"forwarded,omitempty"`
+		FundTx      string `json:"fundTx,omitempty"`
+		ClaimTx     string `json:"claimTx,omitempty"`
+		TransferTx  string `json:"transferTx,omitempty"`
+		Error       string `json:"error,omitempty"`
+	}
+	var report []rescueReport
+	failed := false
+	for _, r := range results {
+		report = append(report, rescueReport{
+			Address:     r.Address.Hex(),
+			Destination: r.Destination,
+			Claimed:     amountOrEmpty(r.Claimed, r.Decimals),
+			Forwarded:   amountOrEmpty(r.Forwarded, r.Decimals),
+			FundTx:      r.FundTx,
+			ClaimTx:     r.ClaimTx,
+			TransferTx:  r.WithdrawTx,
+			Error:       errString(r.Err),
+		})
+		failed = failed || r.Err != nil
+	}
+	c.print(report, func(w *tabwriter.Writer) {
+		printSummary(w, results)
+	})
+	c.printDryRun()
+	if failed {
+		return errSomeFailed
+	}
+	return nil
+}
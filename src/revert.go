@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"claimer/dist"
+	"claimer/token"
+)
+
+var (
+	errClaimNotStarted     = errors.New("claim period has not started")
+	errInsufficientBalance = errors.New("insufficient token balance")
+)
+
+// Known revert strings of the distributor and the token
+var revertReasons = map[string]error{
+	"TokenDistributor: claim not started":    errClaimNotStarted,
+	"TokenDistributor: claim ended":          errClaimWindowClosed,
+	"TokenDistributor: nothing to claim":     errNothingToClaim,
+	"ERC20: transfer amount exceeds balance": errInsufficientBalance,
+}
+
+// RevertError is a decoded revert of a call or a mined transaction. It
+// unwraps to one of the sentinel errors above when the reason is known.
+type RevertError struct {
+	Reason string
+	Data   []byte
+	kind   error
+}
+
+func (e *RevertError) Error() string {
+	return "execution reverted: " + e.Reason
+}
+
+func (e *RevertError) Unwrap() error {
+	return e.kind
+}
+
+// isPermanent reports whether retrying can never succeed
+func isPermanent(err error) bool {
+	return errors.Is(err, errNothingToClaim) ||
+		errors.Is(err, errClaimWindowClosed) ||
+		errors.Is(err, errInsufficientBalance) ||
+		errors.Is(err, errResignFailed) ||
+		errors.Is(err, errDelegationNonceUsed)
+}
+
+// Decode revert data against Error(string) and the custom errors of the
+// distributor and token ABIs
+func decodeRevert(data []byte) *RevertError {
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return &RevertError{Reason: reason, Data: data, kind: revertReasons[reason]}
+	}
+	if len(data) >= 4 {
+		for _, meta := range []string{dist.DistMetaData.ABI, token.TokenMetaData.ABI} {
+			parsed, err := abi.JSON(strings.NewReader(meta))
+			if err != nil {
+				continue
+			}
+			for _, abiErr := range parsed.Errors {
+				if !bytes.Equal(abiErr.ID[:4], data[:4]) {
+					continue
+				}
+				args, err := abiErr.Unpack(data)
+				if err != nil {
+					continue
+				}
+				return &RevertError{Reason: fmt.Sprintf("%s%v", abiErr.Name, args), Data: data}
+			}
+		}
+	}
+	if len(data) == 0 {
+		return &RevertError{Reason: "no reason given"}
+	}
+	return &RevertError{Reason: hexutil.Encode(data), Data: data}
+}
+
+// Turn an error returned by the node into a RevertError when it carries
+// revert data or a revert message, other errors are returned unchanged
+func wrapRevert(err error) error {
+	if err == nil {
+		return nil
+	}
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if s, ok := dataErr.ErrorData().(string); ok {
+			if data, decErr := hexutil.Decode(s); decErr == nil {
+				return decodeRevert(data)
+			}
+		}
+	}
+	msg := err.Error()
+	if i := strings.Index(msg, "execution reverted: "); i >= 0 {
+		reason := msg[i+len("execution reverted: "):]
+		return &RevertError{Reason: reason, kind: revertReasons[reason]}
+	}
+	return err
+}
+
+// Replay a reverted transaction with eth_call at the block it failed in to
+// recover the revert reason
+func (ex *Executor) revertReason(ctx context.Context, tx *types.Transaction, block *big.Int) error {
+	msg := ethereum.CallMsg{
+		From:      ex.account.address,
+		To:        tx.To(),
+		Gas:       tx.Gas(),
+		GasFeeCap: tx.GasFeeCap(),
+		GasTipCap: tx.GasTipCap(),
+		Value:     tx.Value(),
+		Data:      tx.Data(),
+	}
+	_, err := ex.Client().CallContract(ctx, msg, block)
+	if err == nil {
+		log.Printf("Replay of %s did not revert", tx.Hash().Hex())
+		return &RevertError{Reason: "unknown"}
+	}
+	return wrapRevert(err)
+}
+
+// Get the revert reason of a mined transaction by hash
+func (ex *Executor) revertReasonOf(ctx context.Context, hash common.Hash, block *big.Int) error {
+	tx, _, err := ex.Client().TransactionByHash(ctx, hash)
+	if err != nil {
+		log.Printf("Failed to get transaction %s: %v", hash.Hex(), err)
+		return &RevertError{Reason: "unknown"}
+	}
+	return ex.revertReason(ctx, tx, block)
+}
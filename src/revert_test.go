@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// errorString packs reason the way require(cond, reason) reverts with it
+func errorString(t *testing.T, reason string) []byte {
+	t.Helper()
+	typ, err := abi.NewType("string", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := abi.Arguments{{Type: typ}}.Pack(reason)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(hexutil.MustDecode("0x08c379a0"), data...)
+}
+
+// rpcDataError is a node error carrying revert data, like geth returns
+type rpcDataError struct {
+	data interface{}
+}
+
+func (e rpcDataError) Error() string          { return "execution reverted" }
+func (e rpcDataError) ErrorData() interface{} { return e.data }
+
+func TestDecodeRevert(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		reason string
+		kind   error
+	}{
+		{"nothing to claim", errorString(t, "TokenDistributor: nothing to claim"), "TokenDistributor: nothing to claim", errNothingToClaim},
+		{"claim ended", errorString(t, "TokenDistributor: claim ended"), "TokenDistributor: claim ended", errClaimWindowClosed},
+		{"unknown reason", errorString(t, "ERC20: transfer to the zero address"), "ERC20: transfer to the zero address", nil},
+		{"no data", nil, "no reason given", nil},
+		{"undecodable", hexutil.MustDecode("0xdeadbeef"), "0xdeadbeef", nil},
+	}
+	for _, tt := range tests {
+		err := decodeRevert(tt.data)
+		if err.Reason != tt.reason {
+			t.Errorf("%s: reason %q, want %q", tt.name, err.Reason, tt.reason)
+		}
+		if err.Unwrap() != tt.kind {
+			t.Errorf("%s: unwraps to %v, want %v", tt.name, err.Unwrap(), tt.kind)
+		}
+	}
+}
+
+func TestWrapRevert(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		reason    string // empty when the error is not a revert
+		permanent bool
+	}{
+		{"revert data", rpcDataError{hexutil.Encode(errorString(t, "TokenDistributor: claim not started"))}, "TokenDistributor: claim not started", false},
+		{"revert message", errors.New("execution reverted: ERC20: transfer amount exceeds balance"), "ERC20: transfer amount exceeds balance", true},
+		{"other error", errors.New("connection refused"), "", false},
+	}
+	for _, tt := range tests {
+		err := wrapRevert(tt.err)
+		var revert *RevertError
+		if errors.As(err, &revert) != (tt.reason != "") {
+			t.Errorf("%s: got %v", tt.name, err)
+			continue
+		}
+		if revert != nil && revert.Reason != tt.reason {
+			t.Errorf("%s: reason %q, want %q", tt.name, revert.Reason, tt.reason)
+		}
+		if isPermanent(err) != tt.permanent {
+			t.Errorf("%s: isPermanent = %v, want %v", tt.name, isPermanent(err), tt.permanent)
+		}
+	}
+	if wrapRevert(nil) != nil {
+		t.Error("wrapRevert(nil) is not nil")
+	}
+}
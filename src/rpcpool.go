@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Endpoint is one RPC node of the pool
+type Endpoint struct {
+	URL    string
+	RPC    *rpc.Client
+	Client *ethclient.Client
+
+	verified bool // chain ID checked against the expected one
+	rejected bool // reported another chain ID, never used
+	healthy  bool
+	latency  time.Duration
+	head     uint64
+}
+
+// RPCPool keeps several RPC endpoints, reads from the fastest healthy one
+// and broadcasts transactions to all of them.
+type RPCPool struct {
+	mu        sync.RWMutex
+	endpoints []*Endpoint
+	chainID   *big.Int
+	MaxLag    uint64 // blocks an endpoint may trail the best head and stay healthy
+}
+
+var errWrongNetwork = errors.New("endpoint is on the wrong network")
+
+// Dial every url, failing only when none of them can be reached. Endpoints
+// are only used once they report the expected chain ID.
+func dialPool(chainID *big.Int, urls []string) (*RPCPool, error) {
+	pool := &RPCPool{chainID: chainID, MaxLag: 3}
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		rpcClient, err := rpc.Dial(url)
+		if err != nil {
+			log.Printf("Failed to connect to %s: %v", url, err)
+			continue
+		}
+		pool.endpoints = append(pool.endpoints, &Endpoint{
+			URL:    url,
+			RPC:    rpcClient,
+			Client: ethclient.NewClient(rpcClient),
+		})
+	}
+	if len(pool.endpoints) == 0 {
+		return nil, fmt.Errorf("no reachable RPC endpoint")
+	}
+	pool.checkHealth(context.Background())
+	if pool.verified() == 0 {
+		return nil, fmt.Errorf("no endpoint on chain %v", chainID)
+	}
+	return pool, nil
+}
+
+// Count the endpoints known to be on the expected chain
+func (p *RPCPool) verified() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	count := 0
+	for _, ep := range p.endpoints {
+		if ep.verified {
+			count++
+		}
+	}
+	return count
+}
+
+// Check the chain ID of an endpoint against the expected one
+func (p *RPCPool) verify(ctx context.Context, ep *Endpoint) error {
+	chainID, err := ep.Client.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+	if chainID.Cmp(p.chainID) != 0 {
+		return fmt.Errorf("%w: %s reports chain %v, expected %v", errWrongNetwork, ep.URL, chainID, p.chainID)
+	}
+	return nil
+}
+
+// Get the healthy endpoint with the lowest latency, or any verified endpoint
+// when all of them are unhealthy
+func (p *RPCPool) best() *Endpoint {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var best *Endpoint
+	for _, ep := range p.endpoints {
+		if !ep.healthy {
+			continue
+		}
+		if best == nil || ep.latency < best.latency {
+			best = ep
+		}
+	}
+	if best == nil {
+		best = p.endpoints[0]
+		for _, ep := range p.endpoints {
+			if ep.verified {
+				best = ep
+				break
+			}
+		}
+	}
+	return best
+}
+
+// Mark an endpoint unhealthy after a transport error. Errors returned by the
+// node itself, like a revert or a stale nonce, say nothing about its health.
+func (p *RPCPool) report(ep *Endpoint, err error) {
+	if err == nil {
+		return
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) || errors.Is(err, ethereum.NotFound) || errors.Is(err, context.Canceled) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ep.healthy {
+		log.Printf("Endpoint %s unhealthy: %v", ep.URL, err)
+	}
+	ep.healthy = false
+}
+
+// Query the head of every endpoint, measure latency and mark endpoints
+// that fail or lag behind the best head as unhealthy
+func (p *RPCPool) checkHealth(ctx context.Context) {
+	type probe struct {
+		head    uint64
+		latency time.Duration
+		err     error
+	}
+	probes := make([]probe, len(p.endpoints))
+
+	wg := &sync.WaitGroup{}
+	for i, ep := range p.endpoints {
+		wg.Add(1)
+		go func(i int, ep *Endpoint) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			if ep.rejected {
+				probes[i] = probe{err: errWrongNetwork}
+				return
+			}
+			if !ep.verified {
+				err := p.verify(ctx, ep)
+				p.mu.Lock()
+				ep.verified = err == nil
+				ep.rejected = errors.Is(err, errWrongNetwork)
+				p.mu.Unlock()
+				if err != nil {
+					if ep.rejected {
+						log.Printf("Rejecting endpoint: %v", err)
+					}
+					probes[i] = probe{err: err}
+					return
+				}
+			}
+			start := time.Now()
+			head, err := ep.Client.BlockNumber(ctx)
+			probes[i] = probe{head: head, latency: time.Since(start), err: err}
+		}(i, ep)
+	}
+	wg.Wait()
+
+	var top uint64
+	for _, pr := range probes {
+		if pr.err == nil && pr.head > top {
+			top = pr.head
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, ep := range p.endpoints {
+		pr := probes[i]
+		healthy := ep.verified && pr.err == nil && pr.head+p.MaxLag >= top
+		if healthy != ep.healthy {
+			if healthy {
+				log.Printf("Endpoint %s healthy again", ep.URL)
+			} else if pr.err != nil {
+				log.Printf("Endpoint %s unhealthy: %v", ep.URL, pr.err)
+			} else {
+				log.Printf("Endpoint %s unhealthy: head %d, best %d", ep.URL, pr.head, top)
+			}
+		}
+		ep.healthy = healthy
+		if pr.err == nil {
+			ep.head = pr.head
+			ep.latency = pr.latency
+		}
+	}
+}
+
+// Recheck endpoint health every interval until ctx is done
+func (p *RPCPool) monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkHealth(ctx)
+		}
+	}
+}
+
+// Send a signed transaction to every endpoint in parallel. It succeeds as
+// soon as one endpoint accepts the transaction or already knows it.
+func (p *RPCPool) broadcast(ctx context.Context, tx *types.Transaction) error {
+	p.mu.RLock()
+	var endpoints []*Endpoint
+	for _, ep := range p.endpoints {
+		if ep.verified {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	p.mu.RUnlock()
+	if len(endpoints) == 0 {
+		return fmt.Errorf("no endpoint on chain %v", p.chainID)
+	}
+
+	errs := make(chan error, len(endpoints))
+	for _, ep := range endpoints {
+		go func(ep *Endpoint) {
+			err := ep.Client.SendTransaction(ctx, tx)
+			if err != nil && isKnownTx(err) {
+				err = nil
+			}
+			p.report(ep, err)
+			errs <- err
+		}(ep)
+	}
+
+	var firstErr error
+	for range endpoints {
+		err := <-errs
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Send signed transactions to every endpoint in one batch request, so each
+// node receives them together and in order. The error of a transaction is
+// nil once any endpoint accepted it or already knows it.
+func (p *RPCPool) broadcastBatch(ctx context.Context, txs []*types.Transaction) []error {
+	p.mu.RLock()
+	var endpoints []*Endpoint
+	for _, ep := range p.endpoints {
+		if ep.verified {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	p.mu.RUnlock()
+
+	raw := make([]string, len(txs))
+	for i, tx := range txs {
+		data, err := tx.MarshalBinary()
+		if err != nil {
+			errs := make([]error, len(txs))
+			for j := range errs {
+				errs[j] = err
+			}
+			return errs
+		}
+		raw[i] = hexutil.Encode(data)
+	}
+
+	results := make([][]error, len(endpoints))
+	wg := &sync.WaitGroup{}
+	for i, ep := range endpoints {
+		wg.Add(1)
+		go func(i int, ep *Endpoint) {
+			defer wg.Done()
+			batch := make([]rpc.BatchElem, len(txs))
+			for j := range txs {
+				batch[j] = rpc.BatchElem{
+					Method: "eth_sendRawTransaction",
+					Args:   []interface{}{raw[j]},
+					Result: new(common.Hash),
+				}
+			}
+			errs := make([]error, len(txs))
+			err := ep.RPC.BatchCallContext(ctx, batch)
+			p.report(ep, err)
+			for j := range batch {
+				switch {
+				case err != nil:
+					errs[j] = err
+				case batch[j].Error != nil && !isKnownTx(batch[j].Error):
+					errs[j] = batch[j].Error
+				}
+			}
+			results[i] = errs
+		}(i, ep)
+	}
+	wg.Wait()
+
+	errs := make([]error, len(txs))
+	for j := range txs {
+		errs[j] = fmt.Errorf("no endpoint on chain %v", p.chainID)
+		for i := range endpoints {
+			if results[i][j] == nil {
+				errs[j] = nil
+				break
+			}
+			if i == 0 {
+				errs[j] = results[i][j]
+			}
+		}
+	}
+	return errs
+}
+
+// isKnownTx reports whether a node rejected a transaction it already has
+func isKnownTx(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
+
+// The methods below make Chain a bind.ContractBackend that routes every
+// call to the currently best endpoint of its pool.
+
+func (c *Chain) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	ep := c.pool.best()
+	code, err := ep.Client.CodeAt(ctx, contract, blockNumber)
+	c.pool.report(ep, err)
+	return code, err
+}
+
+func (c *Chain) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	ep := c.pool.best()
+	out, err := ep.Client.CallContract(ctx, call, blockNumber)
+	c.pool.report(ep, err)
+	return out, err
+}
+
+func (c *Chain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	ep := c.pool.best()
+	header, err := ep.Client.HeaderByNumber(ctx, number)
+	c.pool.report(ep, err)
+	return header, err
+}
+
+func (c *Chain) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	ep := c.pool.best()
+	code, err := ep.Client.PendingCodeAt(ctx, account)
+	c.pool.report(ep, err)
+	return code, err
+}
+
+func (c *Chain) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	ep := c.pool.best()
+	nonce, err := ep.Client.PendingNonceAt(ctx, account)
+	c.pool.report(ep, err)
+	return nonce, err
+}
+
+func (c *Chain) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	ep := c.pool.best()
+	price, err := ep.Client.SuggestGasPrice(ctx)
+	c.pool.report(ep, err)
+	return price, err
+}
+
+func (c *Chain) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	ep := c.pool.best()
+	tip, err := ep.Client.SuggestGasTipCap(ctx)
+	c.pool.report(ep, err)
+	return tip, err
+}
+
+func (c *Chain) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	ep := c.pool.best()
+	gas, err := ep.Client.EstimateGas(ctx, call)
+	c.pool.report(ep, err)
+	return gas, err
+}
+
+func (c *Chain) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return c.pool.broadcast(ctx, tx)
+}
+
+// SendTransactions broadcasts several transactions together, see broadcastBatch
+func (c *Chain) SendTransactions(ctx context.Context, txs []*types.Transaction) []error {
+	return c.pool.broadcastBatch(ctx, txs)
+}
+
+func (c *Chain) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	ep := c.pool.best()
+	logs, err := ep.Client.FilterLogs(ctx, query)
+	c.pool.report(ep, err)
+	return logs, err
+}
+
+func (c *Chain) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	ep := c.pool.best()
+	return ep.Client.SubscribeFilterLogs(ctx, query, ch)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var errClaimWindowClosed = errors.New("claim period has ended")
+
+// Backoff controls the delay between failed attempts
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+func (b Backoff) next(delay time.Duration) time.Duration {
+	delay = time.Duration(float64(delay) * b.Multiplier)
+	if delay > b.Max {
+		delay = b.Max
+	}
+	return delay
+}
+
+// Scheduler waits for the claim window of the distributor and fires the
+// claim as soon as it opens.
+type Scheduler struct {
+	claimer      *Claimer
+	LeadBlocks   uint64        // start firing this many blocks before the window opens
+	PollInterval time.Duration // how often the block number is checked while waiting
+	Backoff      Backoff       // delay between failed sends once firing
+
+	end uint64 // last block of the claim window, set by waitForWindow
+}
+
+// NewScheduler creates a Scheduler with default timings
+func NewScheduler(cl *Claimer) *Scheduler {
+	return &Scheduler{
+		claimer:      cl,
+		PollInterval: 500 * time.Millisecond,
+		Backoff: Backoff{
+			Initial:    200 * time.Millisecond,
+			Max:        5 * time.Second,
+			Multiplier: 2,
+		},
+	}
+}
+
+// Get the block range in which claiming is allowed
+func (cl *Claimer) claimWindow() (uint64, uint64, error) {
+	start, err := cl.distContract.ClaimPeriodStart(&bind.CallOpts{})
+	if err != nil {
+		log.Printf("Failed to get claim period start: %v", err)
+		return 0, 0, err
+	}
+	end, err := cl.distContract.ClaimPeriodEnd(&bind.CallOpts{})
+	if err != nil {
+		log.Printf("Failed to get claim period end: %v", err)
+		return 0, 0, err
+	}
+	return start.Uint64(), end.Uint64(), nil
+}
+
+// Get the block number seen by contracts. On Arbitrum block.number is the
+// L1 block number, which the node reports as l1BlockNumber.
+func (ex *Executor) l1BlockNumber() (uint64, error) {
+	var head struct {
+		Number        *hexutil.Big `json:"number"`
+		L1BlockNumber *hexutil.Big `json:"l1BlockNumber"`
+	}
+	err := ex.chain.RPC().CallContext(context.Background(), &head, "eth_getBlockByNumber", "latest", false)
+	if err != nil {
+		log.Printf("Failed to get latest block: %v", err)
+		return 0, err
+	}
+	if head.L1BlockNumber != nil {
+		return (*big.Int)(head.L1BlockNumber).Uint64(), nil
+	}
+	if head.Number == nil {
+		return 0, fmt.Errorf("latest block has no number")
+	}
+	return (*big.Int)(head.Number).Uint64(), nil
+}
+
+// Block until the claim window is about to open
+func (s *Scheduler) waitForWindow(ctx context.Context) error {
+	return s.waitForBlock(ctx, s.LeadBlocks)
+}
+
+// Block until the claim window is open, ignoring the lead. Used after a
+// claim fired ahead of the window reverted, so the next one can't.
+func (s *Scheduler) waitForStart(ctx context.Context) error {
+	return s.waitForBlock(ctx, 0)
+}
+
+// Block until lead blocks before the claim window opens
+func (s *Scheduler) waitForBlock(ctx context.Context, lead uint64) error {
+	start, end, err := s.claimer.claimWindow()
+	if err != nil {
+		return err
+	}
+	log.Printf("Claim window: blocks %d to %d", start, end)
+	s.end = end
+
+	if s.claimer.dryRun != nil {
+		// nothing is sent, so there is no point in waiting
+		block, err := s.claimer.l1BlockNumber()
+		if err != nil {
+			return err
+		}
+		if block >= end {
+			return errClaimWindowClosed
+		}
+		if block < start {
+			log.Printf("Dry run: not waiting for block %d, current %d", start, block)
+		}
+		return nil
+	}
+
+	blocks, stop := s.claimer.newBlocks(ctx, s.PollInterval)
+	defer stop()
+
+	var last uint64
+	for {
+		block, err := s.claimer.l1BlockNumber()
+		if err == nil {
+			if block >= end {
+				return errClaimWindowClosed
+			}
+			if block+lead >= start {
+				log.Printf("Claim window opening at block %d, current %d", start, block)
+				return nil
+			}
+			if block != last {
+				log.Printf("Waiting for block %d, current %d", start, block)
+				last = block
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-blocks:
+		}
+	}
+}
+
+// Call send until it succeeds, backing off between failures. When
+// untilClose is set, give up once the claim window has ended.
+func (s *Scheduler) fire(ctx context.Context, untilClose bool, send func() (string, error)) (string, error) {
+	delay := s.Backoff.Initial
+	for {
+		hash, err := send()
+		if err == nil {
+			return hash, nil
+		}
+		log.Println(err)
+		if isPermanent(err) {
+			return "", err
+		}
+
+		if untilClose && s.end != 0 {
+			block, err := s.claimer.l1BlockNumber()
+			if err == nil && block >= s.end {
+				return "", errClaimWindowClosed
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = s.Backoff.next(delay)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Signer signs transactions and EIP-712 messages for one account, wherever
+// its key is kept
+type Signer interface {
+	Address() common.Address
+	SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+	// SignTypedData returns a 65 byte signature with v of 27 or 28
+	SignTypedData(ctx context.Context, data apitypes.TypedData) ([]byte, error)
+}
+
+// keySigner signs with a private key held in memory, given raw, decrypted
+// from a keystore file or derived from a mnemonic
+type keySigner struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+}
+
+func newKeySigner(key *ecdsa.PrivateKey) *keySigner {
+	return &keySigner{
+		key:     key,
+		address: crypto.PubkeyToAddress(key.PublicKey),
+	}
+}
+
+func (s *keySigner) Address() common.Address {
+	return s.address
+}
+
+func (s *keySigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.key)
+}
+
+func (s *keySigner) SignTypedData(ctx context.Context, data apitypes.TypedData) ([]byte, error) {
+	digest, _, err := apitypes.TypedDataAndHash(data)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := crypto.Sign(digest, s.key)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+// remoteSigner asks a signer speaking the Clef account_ JSON-RPC API, so
+// the key never has to be on this host. Everything it returns is checked
+// against what was asked for.
+type remoteSigner struct {
+	client  *rpc.Client
+	url     string
+	address common.Address
+}
+
+func newRemoteSigner(url string, address common.Address) (*remoteSigner, error) {
+	client, err := rpc.Dial(url)
+	if err != nil {
+		log.Printf("Failed to connect to signer %s: %v", url, err)
+		return nil, err
+	}
+	return &remoteSigner{client: client, url: url, address: address}, nil
+}
+
+func (s *remoteSigner) Address() common.Address {
+	return s.address
+}
+
+// signTransactionResult is the reply of account_signTransaction
+type signTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+func (s *remoteSigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	data := hexutil.Bytes(tx.Data())
+	args := apitypes.SendTxArgs{
+		From:                 common.NewMixedcaseAddress(s.address),
+		Gas:                  hexutil.Uint64(tx.Gas()),
+		MaxFeePerGas:         (*hexutil.Big)(tx.GasFeeCap()),
+		MaxPriorityFeePerGas: (*hexutil.Big)(tx.GasTipCap()),
+		Value:                hexutil.Big(*tx.Value()),
+		Nonce:                hexutil.Uint64(tx.Nonce()),
+		Data:                 &data,
+		ChainID:              (*hexutil.Big)(chainID),
+	}
+	if tx.To() != nil {
+		to := common.NewMixedcaseAddress(*tx.To())
+		args.To = &to
+	}
+	var res signTransactionResult
+	if err := s.client.CallContext(ctx, &res, "account_signTransaction", &args); err != nil {
+		return nil, fmt.Errorf("signer %s: %w", s.url, err)
+	}
+	signedTx := new(types.Transaction)
+	if err := signedTx.UnmarshalBinary(res.Raw); err != nil {
+		return nil, fmt.Errorf("signer %s: %w", s.url, err)
+	}
+
+	// the signer may let its user edit the transaction, take it only as asked
+	signer := types.LatestSignerForChainID(chainID)
+	if signer.Hash(signedTx) != signer.Hash(tx) {
+		return nil, fmt.Errorf("signer %s changed the transaction", s.url)
+	}
+	if from, err := types.Sender(signer, signedTx); err != nil || from != s.address {
+		return nil, fmt.Errorf("signer %s signed with another account", s.url)
+	}
+	return signedTx, nil
+}
+
+func (s *remoteSigner) SignTypedData(ctx context.Context, data apitypes.TypedData) ([]byte, error) {
+	var sig hexutil.Bytes
+	addr := common.NewMixedcaseAddress(s.address)
+	if err := s.client.CallContext(ctx, &sig, "account_signTypedData", &addr, data); err != nil {
+		return nil, fmt.Errorf("signer %s: %w", s.url, err)
+	}
+	if len(sig) != 65 {
+		return nil, fmt.Errorf("signer %s: signature of %d bytes", s.url, len(sig))
+	}
+
+	digest, _, err := apitypes.TypedDataAndHash(data)
+	if err != nil {
+		return nil, err
+	}
+	rsv := append([]byte{}, sig...)
+	if rsv[64] >= 27 {
+		rsv[64] -= 27
+	}
+	pub, err := crypto.SigToPub(digest, rsv)
+	if err != nil || crypto.PubkeyToAddress(*pub) != s.address {
+		return nil, fmt.Errorf("signer %s signed with another account", s.url)
+	}
+	if sig[64] < 27 {
+		sig[64] += 27
+	}
+	return sig, nil
+}
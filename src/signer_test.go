@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+var testChainID = big.NewInt(42161)
+
+// tamperingAPI raises the gas limit of every transaction before signing
+// it, the way a signer letting its user edit requests could
+type tamperingAPI struct {
+	*stubSignerAPI
+}
+
+func (api *tamperingAPI) SignTransaction(ctx context.Context, args apitypes.SendTxArgs, methodSelector *string) (*signTransactionResult, error) {
+	args.Gas++
+	return api.stubSignerAPI.SignTransaction(ctx, args, methodSelector)
+}
+
+// Serve api over HTTP and connect a remote signer for address to it
+func serveSigner(t *testing.T, api interface{}, address common.Address) *remoteSigner {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", api); err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(server)
+	t.Cleanup(hs.Close)
+	t.Cleanup(server.Stop)
+
+	signer, err := newRemoteSigner(hs.URL, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(signer.client.Close)
+	return signer
+}
+
+// A stub signer answering for address with the given signer
+func stubFor(address common.Address, signer Signer) *stubSignerAPI {
+	return &stubSignerAPI{
+		chainID: testChainID,
+		signers: map[common.Address]Signer{address: signer},
+		order:   []common.Address{address},
+	}
+}
+
+func newTestKeySigner(t *testing.T) *keySigner {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newKeySigner(key)
+}
+
+func testTx() *types.Transaction {
+	to := common.HexToAddress("0x912CE59144191C1204E64559FE8253a0e49E6548")
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   testChainID,
+		Nonce:     7,
+		GasTipCap: big.NewInt(0),
+		GasFeeCap: big.NewInt(100000000),
+		Gas:       300000,
+		To:        &to,
+		Value:     new(big.Int),
+		Data:      hexutil.MustDecode("0xa9059cbb"),
+	})
+}
+
+func testDelegation() apitypes.TypedData {
+	domain := apitypes.TypedDataDomain{
+		Name:              "Arbitrum",
+		Version:           "1",
+		ChainId:           (*math.HexOrDecimal256)(testChainID),
+		VerifyingContract: "0x912CE59144191C1204E64559FE8253a0e49E6548",
+	}
+	return delegationData(domain, common.HexToAddress("0x1111111111111111111111111111111111111111"), big.NewInt(3), big.NewInt(1700000000))
+}
+
+func TestRemoteSignTx(t *testing.T) {
+	local := newTestKeySigner(t)
+	remote := serveSigner(t, stubFor(local.Address(), local), local.Address())
+
+	tx := testTx()
+	signedTx, err := remote.SignTx(context.Background(), tx, testChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := types.LatestSignerForChainID(testChainID)
+	if signer.Hash(signedTx) != signer.Hash(tx) {
+		t.Error("signed transaction differs from the request")
+	}
+	if from, err := types.Sender(signer, signedTx); err != nil || from != local.Address() {
+		t.Errorf("sender %s, %v, want %s", from.Hex(), err, local.Address().Hex())
+	}
+}
+
+func TestRemoteSignTypedData(t *testing.T) {
+	local := newTestKeySigner(t)
+	remote := serveSigner(t, stubFor(local.Address(), local), local.Address())
+
+	data := testDelegation()
+	raw, err := remote.SignTypedData(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := raw[64]; v != 27 && v != 28 {
+		t.Errorf("v = %d, want 27 or 28", v)
+	}
+	sig := &Signature{V: raw[64]}
+	copy(sig.R[:], raw[:32])
+	copy(sig.S[:], raw[32:64])
+	if signer, err := recoverTypedData(data, sig); err != nil || signer != local.Address() {
+		t.Errorf("recovered %s, %v, want %s", signer.Hex(), err, local.Address().Hex())
+	}
+}
+
+func TestRemoteSignerRejects(t *testing.T) {
+	local := newTestKeySigner(t)
+	other := newTestKeySigner(t)
+	otherChain := stubFor(local.Address(), local)
+	otherChain.chainID = big.NewInt(1)
+
+	tests := []struct {
+		name    string
+		api     interface{}
+		address common.Address
+		typed   bool
+		want    string
+	}{
+		{"changed transaction", &tamperingAPI{stubFor(local.Address(), local)}, local.Address(), false, "changed the transaction"},
+		{"transaction of another account", stubFor(local.Address(), other), local.Address(), false, "another account"},
+		{"typed data of another account", stubFor(local.Address(), other), local.Address(), true, "another account"},
+		{"unknown account", stubFor(local.Address(), local), other.Address(), false, "unknown account"},
+		{"other chain", otherChain, local.Address(), false, "chainid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := serveSigner(t, tt.api, tt.address)
+			var err error
+			if tt.typed {
+				_, err = remote.SignTypedData(context.Background(), testDelegation())
+			} else {
+				_, err = remote.SignTx(context.Background(), testTx(), testChainID)
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// stubSignerAPI answers the account_ methods of Clef for a set of local
+// keys and approves every request. It stands in for a real signer when
+// testing a remote signer setup, never use it to guard real funds.
+type stubSignerAPI struct {
+	chainID *big.Int
+	signers map[common.Address]Signer
+	order   []common.Address
+}
+
+func (api *stubSignerAPI) signer(addr common.Address) (Signer, error) {
+	s, ok := api.signers[addr]
+	if !ok {
+		return nil, fmt.Errorf("unknown account %s", addr.Hex())
+	}
+	return s, nil
+}
+
+// List serves account_list
+func (api *stubSignerAPI) List(ctx context.Context) ([]common.Address, error) {
+	return api.order, nil
+}
+
+// Version serves account_version
+func (api *stubSignerAPI) Version(ctx context.Context) (string, error) {
+	return "stub", nil
+}
+
+// SignTransaction serves account_signTransaction
+func (api *stubSignerAPI) SignTransaction(ctx context.Context, args apitypes.SendTxArgs, methodSelector *string) (*signTransactionResult, error) {
+	if args.ChainID != nil && args.ChainID.ToInt().Cmp(api.chainID) != 0 {
+		return nil, fmt.Errorf("requested chainid %d does not match the configuration of the signer", args.ChainID.ToInt())
+	}
+	s, err := api.signer(args.From.Address())
+	if err != nil {
+		return nil, err
+	}
+	signedTx, err := s.SignTx(ctx, args.ToTransaction(), api.chainID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signedTx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Signed transaction %s from %s at nonce %d", signedTx.Hash().Hex(), args.From.Address().Hex(), signedTx.Nonce())
+	return &signTransactionResult{Raw: raw, Tx: signedTx}, nil
+}
+
+// SignTypedData serves account_signTypedData
+func (api *stubSignerAPI) SignTypedData(ctx context.Context, addr common.MixedcaseAddress, data apitypes.TypedData) (hexutil.Bytes, error) {
+	s, err := api.signer(addr.Address())
+	if err != nil {
+		return nil, err
+	}
+	sig, err := s.SignTypedData(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Signed %s for %s", data.PrimaryType, addr.Address().Hex())
+	return sig, nil
+}
+
+// stub-signer serves the wallets of the profile over the Clef JSON-RPC API,
+// so a claimer elsewhere can use them as remote signers
+func cmdStubSigner(args []string) error {
+	fs := flag.NewFlagSet("stub-signer", flag.ExitOnError)
+	pf := bindProfileFlags(fs)
+	listen := fs.String("listen", "127.0.0.1:8550", "address to serve the signer API on")
+	fs.Parse(args)
+
+	settings, err := loadSettings(fs, pf)
+	if err != nil {
+		return err
+	}
+	wallets, err := openWallets(settings.Wallets)
+	if err != nil {
+		return err
+	}
+	api := &stubSignerAPI{
+		chainID: settings.Network.ChainID,
+		signers: map[common.Address]Signer{},
+	}
+	accounts := make([]*Account, 0, len(wallets)+2)
+	for _, w := range wallets {
+		accounts = append(accounts, w.Account)
+	}
+	for _, spec := range []*WalletSpec{settings.Relayer, settings.Funder} {
+		if spec == nil {
+			continue
+		}
+		account, err := openAccount(*spec)
+		if err != nil {
+			return err
+		}
+		accounts = append(accounts, account)
+	}
+	for _, account := range accounts {
+		if _, ok := api.signers[account.address]; !ok {
+			api.signers[account.address] = account.signer
+			api.order = append(api.order, account.address)
+		}
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", api); err != nil {
+		return err
+	}
+	log.Printf("Stub signer for %d accounts on chain %v listening on http://%s", len(api.order), api.chainID, *listen)
+	return http.ListenAndServe(*listen, server)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+)
+
+// Call is an unsigned transaction: a contract method call or an ETH
+// transfer, with the state its gas estimate should assume
+type Call struct {
+	To        common.Address
+	Value     *big.Int
+	Data      []byte
+	Overrides map[common.Address]gethclient.OverrideAccount
+}
+
+// Pack a call of method on the contract at address, with the ABI of meta
+func packCall(meta *bind.MetaData, address common.Address, method string, args ...interface{}) (*Call, error) {
+	parsed, err := meta.GetAbi()
+	if err != nil {
+		log.Printf("Failed to parse ABI: %v", err)
+		return nil, err
+	}
+	data, err := parsed.Pack(method, args...)
+	if err != nil {
+		log.Printf("Failed to pack %s: %v", method, err)
+		return nil, err
+	}
+	return &Call{To: address, Value: new(big.Int), Data: data}, nil
+}
+
+// Build a transfer of amount wei to address
+func transferCall(address common.Address, amount *big.Int) *Call {
+	return &Call{To: address, Value: amount}
+}
+
+// Sign a call at the given nonce without sending it. Fees come from the fee
+// policy and the gas limit from an estimate.
+func (ex *Executor) signCall(nonce uint64, call *Call) (*types.Transaction, error) {
+	fees, err := ex.getFees()
+	if err != nil {
+		return nil, err
+	}
+	gas, err := ex.gasLimit(ethereum.CallMsg{To: &call.To, Value: call.Value, Data: call.Data}, call.Overrides)
+	if err != nil {
+		return nil, err
+	}
+	to := call.To
+	return ex.signTx(&types.DynamicFeeTx{
+		ChainID:   ex.chain.ChainID,
+		Nonce:     nonce,
+		GasTipCap: fees.TipCap,
+		GasFeeCap: fees.FeeCap,
+		Gas:       gas,
+		To:        &to,
+		Value:     call.Value,
+		Data:      call.Data,
+	})
+}
+
+// Reserve sequential nonces and sign one call at each, so they can be sent
+// back to back later
+func (ex *Executor) signCalls(calls ...*Call) ([]*types.Transaction, error) {
+	nonce, err := ex.reserveNonces(uint64(len(calls)))
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]*types.Transaction, len(calls))
+	for i, call := range calls {
+		txs[i], err = ex.signCall(nonce+uint64(i), call)
+		if err != nil {
+			for n := nonce + uint64(len(calls)); n > nonce; n-- {
+				ex.releaseNonce(n - 1)
+			}
+			return nil, err
+		}
+	}
+	return txs, nil
+}
+
+// Sign a transaction through the signer of the account, the one place
+// transactions get signed
+func (ex *Executor) signTx(inner types.TxData) (*types.Transaction, error) {
+	signedTx, err := ex.account.signer.SignTx(context.Background(), types.NewTx(inner), ex.chain.ChainID)
+	if err != nil {
+		log.Printf("Failed to sign transaction: %v", err)
+		return nil, err
+	}
+	return signedTx, nil
+}
+
+// Submit a call: reserve a nonce, sign, send, journal and wait until it is
+// mined. Returns the hash as soon as it is known, even when waiting fails.
+func (ex *Executor) Submit(ctx context.Context, call *Call, timeout time.Duration) (string, *TxOutcome, error) {
+	return ex.submit(ctx, call, timeout, ex.sendTx, ex.confirm)
+}
+
+// Submit a call of the claimer, simulated in a dry run and with the claim
+// and transfer events decoded
+func (cl *Claimer) Submit(ctx context.Context, call *Call, timeout time.Duration) (string, *TxOutcome, error) {
+	return cl.submit(ctx, call, timeout, cl.sendTx, cl.confirm)
+}
+
+func (ex *Executor) submit(ctx context.Context, call *Call, timeout time.Duration,
+	send func(*types.Transaction) (string, error),
+	confirm func(context.Context, string, time.Duration) (*TxOutcome, error)) (string, *TxOutcome, error) {
+	txs, err := ex.signCalls(call)
+	if err != nil {
+		return "", nil, err
+	}
+	hash, err := send(txs[0])
+	if err != nil {
+		// refused everywhere, so the nonce is still free
+		ex.releaseNonce(txs[0].Nonce())
+		return "", nil, err
+	}
+	outcome, err := confirm(ctx, hash, timeout)
+	return hash, outcome, err
+}
+
+// Wait for a transaction of the executor, or report its simulation in a
+// dry run
+func (ex *Executor) confirm(ctx context.Context, hash string, timeout time.Duration) (*TxOutcome, error) {
+	if ex.dryRun != nil {
+		return ex.simulatedOutcome(hash)
+	}
+	outcome, _, err := ex.confirmTx(ctx, hash, timeout, nil)
+	return outcome, err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// parseUnits converts a decimal string such as "625.5" into an integer amount
+// scaled by 10^decimals, without going through float64.
+func parseUnits(value string, decimals uint8) (*big.Int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("empty amount")
+	}
+	whole, frac, _ := strings.Cut(value, ".")
+	if whole+frac == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return nil, fmt.Errorf("invalid amount %q", value)
+	}
+	if len(frac) > int(decimals) {
+		return nil, fmt.Errorf("amount %q has more than %d decimals", value, decimals)
+	}
+	digits := whole + frac + strings.Repeat("0", int(decimals)-len(frac))
+	amount, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", value)
+	}
+	return amount, nil
+}
+
+// formatUnits renders an integer amount scaled by 10^decimals as a decimal
+// string, trimming trailing zeros of the fraction.
+func formatUnits(amount *big.Int, decimals uint8) string {
+	sign := ""
+	digits := new(big.Int).Abs(amount).String()
+	if amount.Sign() < 0 {
+		sign = "-"
+	}
+	if len(digits) <= int(decimals) {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+	whole := digits[:len(digits)-int(decimals)]
+	frac := strings.TrimRight(digits[len(digits)-int(decimals):], "0")
+	if frac == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + frac
+}
+
+// formatAmount is formatUnits for optional amounts
+func formatAmount(amount *big.Int, decimals uint8) string {
+	if amount == nil {
+		return "-"
+	}
+	return formatUnits(amount, decimals)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseUnits(t *testing.T) {
+	tests := []struct {
+		value    string
+		decimals uint8
+		want     string // empty when the value is rejected
+	}{
+		{"625.5", 18, "625500000000000000000"},
+		{"1", 18, "1000000000000000000"},
+		{"0.000000000000000001", 18, "1"},
+		{".5", 2, "50"},
+		{"5.", 2, "500"},
+		{" 42 ", 0, "42"},
+		{"0.1", 9, "100000000"},
+		{"-1", 18, ""},
+		{"-0", 18, ""},
+		{"+1", 18, ""},
+		{"1e3", 18, ""},
+		{"1.2.3", 18, ""},
+		{"0x10", 18, ""},
+		{"1_000", 18, ""},
+		{".", 18, ""},
+		{"", 18, ""},
+		{"0.0000000000000000001", 18, ""},
+		{"1.5", 0, ""},
+	}
+	for _, tt := range tests {
+		got, err := parseUnits(tt.value, tt.decimals)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("parseUnits(%q, %d) = %v, want an error", tt.value, tt.decimals, got)
+			}
+			continue
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("parseUnits(%q, %d) = %v, %v, want %s", tt.value, tt.decimals, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatUnits(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals uint8
+		want     string
+	}{
+		{"625500000000000000000", 18, "625.5"},
+		{"1000000000000000000", 18, "1"},
+		{"1", 18, "0.000000000000000001"},
+		{"0", 18, "0"},
+		{"-1500000000000000000", 18, "-1.5"},
+		{"42", 0, "42"},
+	}
+	for _, tt := range tests {
+		amount, _ := new(big.Int).SetString(tt.amount, 10)
+		if got := formatUnits(amount, tt.decimals); got != tt.want {
+			t.Errorf("formatUnits(%s, %d) = %s, want %s", tt.amount, tt.decimals, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"claimer/dist"
+	"claimer/token"
+)
+
+// Open the optional websocket connection used for subscriptions
+func (c *Chain) dialWS(url string) error {
+	client, err := ethclient.Dial(url)
+	if err != nil {
+		log.Printf("Failed to connect to websocket %s: %v", url, err)
+		return err
+	}
+	chainID, err := client.ChainID(context.Background())
+	if err != nil {
+		log.Printf("Failed to get chain ID: %v", err)
+		client.Close()
+		return err
+	}
+	if chainID.Cmp(c.ChainID) != 0 {
+		client.Close()
+		return fmt.Errorf("%w: %s reports chain %v, expected %v", errWrongNetwork, url, chainID, c.ChainID)
+	}
+	c.ws = client
+	return nil
+}
+
+// Get a channel that fires once per new block. With a websocket connection
+// it follows new heads, otherwise, or when the subscription breaks, it
+// falls back to polling every interval. Call stop to release it.
+func (ex *Executor) newBlocks(ctx context.Context, interval time.Duration) (<-chan struct{}, func()) {
+	ctx, stop := context.WithCancel(ctx)
+	ticks := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case ticks <- struct{}{}:
+		default:
+		}
+	}
+
+	go func() {
+		if ex.chain.ws != nil {
+			err := ex.followHeads(ctx, notify)
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("New head subscription failed, polling instead: %v", err)
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				notify()
+			}
+		}
+	}()
+	return ticks, stop
+}
+
+// Call notify on every new head until ctx is done or the subscription fails
+func (ex *Executor) followHeads(ctx context.Context, notify func()) error {
+	heads := make(chan *types.Header)
+	sub, err := ex.chain.ws.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return err
+		case <-heads:
+			notify()
+		}
+	}
+}
+
+// Watch distributor and token events of the account and nudge whenever the
+// claim lands or tokens move. Returns nil without a websocket connection.
+func (cl *Claimer) watchEvents(ctx context.Context) <-chan struct{} {
+	if cl.chain.ws == nil {
+		return nil
+	}
+	distFilterer, err := dist.NewDistFilterer(cl.distAddress, cl.chain.ws)
+	if err != nil {
+		log.Printf("Failed to build distributor filterer: %v", err)
+		return nil
+	}
+	tokenFilterer, err := token.NewTokenFilterer(cl.tokenAddress, cl.chain.ws)
+	if err != nil {
+		log.Printf("Failed to build token filterer: %v", err)
+		return nil
+	}
+
+	opts := &bind.WatchOpts{Context: ctx}
+	recipient := []common.Address{cl.account.address}
+	canClaim := make(chan *dist.DistCanClaim)
+	hasClaimed := make(chan *dist.DistHasClaimed)
+	transfers := make(chan *token.TokenTransfer)
+
+	canSub, err := distFilterer.WatchCanClaim(opts, canClaim, recipient)
+	if err != nil {
+		log.Printf("Failed to watch CanClaim: %v", err)
+		return nil
+	}
+	hasSub, err := distFilterer.WatchHasClaimed(opts, hasClaimed, recipient)
+	if err != nil {
+		canSub.Unsubscribe()
+		log.Printf("Failed to watch HasClaimed: %v", err)
+		return nil
+	}
+	transferSub, err := tokenFilterer.WatchTransfer(opts, transfers, recipient, nil)
+	if err != nil {
+		canSub.Unsubscribe()
+		hasSub.Unsubscribe()
+		log.Printf("Failed to watch Transfer: %v", err)
+		return nil
+	}
+
+	nudge := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case nudge <- struct{}{}:
+		default:
+		}
+	}
+	go func() {
+		defer canSub.Unsubscribe()
+		defer hasSub.Unsubscribe()
+		defer transferSub.Unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-canClaim:
+				log.Printf("CanClaim for %s: %v in tx %s", ev.Recipient.Hex(), ev.Amount, ev.Raw.TxHash.Hex())
+			case ev := <-hasClaimed:
+				log.Printf("HasClaimed for %s: %v in tx %s", ev.Recipient.Hex(), ev.Amount, ev.Raw.TxHash.Hex())
+				notify()
+			case ev := <-transfers:
+				log.Printf("Transfer from %s to %s: %v in tx %s", ev.From.Hex(), ev.To.Hex(), ev.Value, ev.Raw.TxHash.Hex())
+				notify()
+			case err := <-canSub.Err():
+				log.Printf("CanClaim subscription failed: %v", err)
+				return
+			case err := <-hasSub.Err():
+				log.Printf("HasClaimed subscription failed: %v", err)
+				return
+			case err := <-transferSub.Err():
+				log.Printf("Transfer subscription failed: %v", err)
+				return
+			}
+		}
+	}()
+	return nudge
+}